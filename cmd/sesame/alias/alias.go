@@ -0,0 +1,132 @@
+package alias
+
+import (
+	"errors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const DefaultFileName = "aliases.yaml"
+
+// Targets are what an alias stands for, instance ids or target expressions. A single target may be
+// written as a plain string in the file.
+type Targets []string
+
+func (t *Targets) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = Targets{value.Value}
+		return nil
+	}
+	var targets []string
+	if err := value.Decode(&targets); err != nil {
+		return err
+	}
+	*t = targets
+	return nil
+}
+
+// Registry is the aliases file, e.g.
+//
+//	aliases:
+//	  DrStrange: mi-01d856ea25bf2f111
+//	  lab:
+//	    - mi-01d856ea25bf2f111
+//	    - Team=lab and ping=Online
+type Registry struct {
+	Aliases map[string]Targets `yaml:"aliases"`
+	path    string
+}
+
+// DefaultPath is aliases.yaml in the sesame user config directory, e.g. ~/.config/sesame/aliases.yaml.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sesame", DefaultFileName), nil
+}
+
+// Load reads the registry at path, a missing file is an empty registry.
+func Load(path string) (*Registry, error) {
+	r := &Registry{Aliases: map[string]Targets{}, path: path}
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	if r.Aliases == nil {
+		r.Aliases = map[string]Targets{}
+	}
+	return r, nil
+}
+
+func (r *Registry) Path() string {
+	return r.path
+}
+
+func (r *Registry) Save() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, b, 0600)
+}
+
+// Add appends targets to the alias, creating it when needed.
+func (r *Registry) Add(name string, targets ...string) {
+	existing := r.Aliases[name]
+	for _, t := range targets {
+		isKnown := false
+		for _, e := range existing {
+			isKnown = isKnown || e == t
+		}
+		if !isKnown {
+			existing = append(existing, t)
+		}
+	}
+	r.Aliases[name] = existing
+}
+
+// Remove deletes the alias and tells if it existed.
+func (r *Registry) Remove(name string) bool {
+	_, ok := r.Aliases[name]
+	delete(r.Aliases, name)
+	return ok
+}
+
+func (r *Registry) Lookup(name string) (Targets, bool) {
+	targets, ok := r.Aliases[name]
+	return targets, ok
+}
+
+// NameOf is the alias standing for exactly this one instance id, for naming hosts in output.
+func (r *Registry) NameOf(instanceId string) (string, bool) {
+	for _, name := range r.Names() {
+		targets := r.Aliases[name]
+		if len(targets) == 1 && targets[0] == instanceId {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Names are the aliases sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.Aliases))
+	for name := range r.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
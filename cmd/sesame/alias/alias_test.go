@@ -0,0 +1,61 @@
+package alias
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadAddSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sesame-alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sesame", DefaultFileName)
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte("aliases:\n  DrStrange: mi-01d856ea25bf2f111\n  lab:\n    - mi-1\n    - Team=lab\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := r.NameOf("mi-01d856ea25bf2f111"); !ok || name != "DrStrange" {
+		t.Errorf("expected DrStrange, got %s", name)
+	}
+	if _, ok := r.NameOf("mi-1"); ok {
+		t.Errorf("a group shouldn't name its members")
+	}
+
+	r.Add("lab", "mi-1", "mi-2")
+	r.Remove("DrStrange")
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded.Names(), []string{"lab"}) {
+		t.Errorf("unexpected names %v", reloaded.Names())
+	}
+	if targets, _ := reloaded.Lookup("lab"); !reflect.DeepEqual(targets, Targets{"mi-1", "Team=lab", "mi-2"}) {
+		t.Errorf("unexpected targets %v", targets)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	r, err := Load(filepath.Join(os.TempDir(), "sesame-does-not-exist", DefaultFileName))
+	if err != nil || len(r.Names()) != 0 {
+		t.Errorf("expected an empty registry, got %v %v", r, err)
+	}
+}
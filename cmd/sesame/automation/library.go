@@ -3,7 +3,6 @@ package automation
 import (
 	"errors"
 	"fmt"
-	"github.com/jroimartin/gocui"
 	"gopkg.in/yaml.v3"
 	"io"
 	"io/ioutil"
@@ -25,7 +24,8 @@ type AutomationLib struct {
 	}
 }
 
-func GetListOfAutomationLibraries(center *gocui.View, directoryToSearch string) []AutomationLib {
+// GetListOfAutomationLibraries reads the automation libraries in directoryToSearch, listing each one it keeps to center.
+func GetListOfAutomationLibraries(center io.Writer, directoryToSearch string) []AutomationLib {
 	files, err := ioutil.ReadDir(directoryToSearch)
 	if err != nil {
 		log.Println(err)
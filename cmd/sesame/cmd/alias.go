@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/Heraclitus/sesame/cmd/sesame/alias"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var aliasesPath string
+var aliasTag string
+var aliasRegistry *alias.Registry
+var aliasRegistryOnce sync.Once
+
+// AliasRecord is one alias as alias ls prints it.
+type AliasRecord struct {
+	Name    string
+	Targets []string
+}
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "manage local aliases for hosts that can't be tagged",
+	Long: `Aliases map a nickname, or a group name, to instance ids and target expressions.
+
+search, gallerate and trackomate look names up here before asking SSM.`,
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:   "add NAME TARGET...",
+	Short: "add instance ids or target expressions to an alias",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name, targets := args[0], args[1:]
+		for _, t := range targets {
+			if !ssmsearch.IsInstanceId(t) {
+				_, err := parseTarget(t)
+				exitOnError(err)
+			}
+		}
+		registry := loadAliases()
+		registry.Add(name, targets...)
+		exitOnError(registry.Save())
+
+		ssmCommand := SSMCommand{}
+		ssmCommand.conf()
+		ctx := context.Background()
+		aliased, _, err := ssmCommand.resolveAlias(ctx, name)
+		exitOnError(err)
+		ssmCommand.warnAliasConflict(ctx, name, aliasTag, aliased)
+	},
+}
+
+var aliasRmCmd = &cobra.Command{
+	Use:   "rm NAME...",
+	Short: "remove aliases",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := loadAliases()
+		for _, name := range args {
+			if !registry.Remove(name) {
+				exitOnError(&SesameError{msg: fmt.Sprintf("No alias [%s].", name)})
+			}
+		}
+		exitOnError(registry.Save())
+	},
+}
+
+var aliasLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list aliases",
+	Args:  ValidateArgsFunc(),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry := loadAliases()
+		items := []interface{}{}
+		for _, name := range registry.Names() {
+			targets, _ := registry.Lookup(name)
+			items = append(items, AliasRecord{Name: name, Targets: targets})
+		}
+		exitOnError(writeOutput(os.Stdout, items, func(w io.Writer) error {
+			tw := newTableWriter(w)
+			_, err := fmt.Fprintln(tw, "ALIAS\tTARGETS")
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				record := item.(AliasRecord)
+				_, err := fmt.Fprintf(tw, "%s\t%s\n", record.Name, strings.Join(record.Targets, " | "))
+				if err != nil {
+					return err
+				}
+			}
+			return tw.Flush()
+		}))
+	},
+}
+
+// loadAliases reads the registry once.
+func loadAliases() *alias.Registry {
+	aliasRegistryOnce.Do(func() {
+		path := aliasesPath
+		if path == "" {
+			var err error
+			path, err = alias.DefaultPath()
+			exitOnError(err)
+		}
+		registry, err := alias.Load(path)
+		exitOnError(err)
+		aliasRegistry = registry
+	})
+	return aliasRegistry
+}
+
+// resolveAlias returns the hosts an alias stands for in this scope, ok is false when name isn't an alias.
+func (ssmCommand *SSMCommand) resolveAlias(ctx context.Context, name string) ([]ssmsearch.Instance, bool, error) {
+	targets, ok := loadAliases().Lookup(name)
+	if !ok {
+		return nil, false, nil
+	}
+	var ids []string
+	var instances []ssmsearch.Instance
+	for _, t := range targets {
+		if ssmsearch.IsInstanceId(t) {
+			ids = append(ids, t)
+			continue
+		}
+		expression, err := parseTarget(t)
+		if err != nil {
+			return nil, true, err
+		}
+		matched, err := ssmCommand.searcher().SearchByExpression(ctx, expression)
+		if err != nil {
+			return nil, true, err
+		}
+		instances = append(instances, matched...)
+	}
+	if len(ids) > 0 {
+		described, err := ssmCommand.searcher().DescribeInstances(ctx, ids)
+		if err != nil {
+			return nil, true, err
+		}
+		instances = append(described, instances...)
+	}
+
+	seen := make(map[string]bool)
+	var unique []ssmsearch.Instance
+	for _, instance := range instances {
+		if !seen[instance.InstanceId] {
+			seen[instance.InstanceId] = true
+			unique = append(unique, instance)
+		}
+	}
+	return unique, true, nil
+}
+
+// warnAliasConflict tells when hosts outside the alias carry its name as a live tag value.
+func (ssmCommand *SSMCommand) warnAliasConflict(ctx context.Context, name string, tagKey string, aliased []ssmsearch.Instance) {
+	live, err := ssmCommand.searcher().SearchByNickname(ctx, name, tagKey)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "could not check alias [%s] against tag %s: %v\n", name, tagKey, err)
+		return
+	}
+	isAliased := make(map[string]bool)
+	for _, instance := range aliased {
+		isAliased[instance.InstanceId] = true
+	}
+	for _, instance := range live {
+		if !isAliased[instance.InstanceId] {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: alias [%s] shadows the live tag %s=%s on [%s], the alias wins.\n", name, tagKey, name, instance.InstanceId)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasAddCmd, aliasRmCmd, aliasLsCmd)
+
+	rootCmd.PersistentFlags().StringVar(&aliasesPath, "aliases", "", "Provide the aliases file. (default: $XDG_CONFIG_HOME/sesame/aliases.yaml)")
+	aliasAddCmd.Flags().StringVarP(&aliasTag, "tag", "t", ssmsearch.DefaultNicknameTag, "Provide the tag name to check the alias against for conflicts.")
+}
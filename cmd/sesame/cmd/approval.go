@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// An automation waits on someone when
+// - the execution is PendingApproval, a change template or runbook needing approval before it runs
+// - the execution is PendingChangeCalendarOverride, a change calendar is closed and the change needs an override
+// - an aws:approve step is Waiting for its Approvers
+// - an aws:pause step is Waiting to be resumed
+// The first three take an Approve or Reject signal, aws:pause a Resume.
+
+const ApprovalActionApprove = "aws:approve"
+const ApprovalActionPause = "aws:pause"
+
+var autoApproveIf []string
+
+// approvalRuleKeys are what an --auto-approve-if rule can match, each against a glob.
+var approvalRuleKeys = []string{"doc", "step", "action", "target", "name", "status"}
+
+// approval is an execution, or one of its steps, waiting on someone.
+type approval struct {
+	AutomationExecutionId string
+	DocumentName          string
+	Status                string
+	Target                string
+	TargetName            string
+	// StepName and Action are empty when the execution as a whole waits.
+	StepName  string
+	Action    string
+	Approvers []string
+	Message   string
+}
+
+func (waiting approval) key() string {
+	return waiting.AutomationExecutionId + "/" + waiting.StepName
+}
+
+func (waiting approval) isPause() bool {
+	return waiting.Action == ApprovalActionPause
+}
+
+// approvalRule approves whatever matches all of its key=glob conditions.
+type approvalRule map[string]string
+
+func parseApprovalRules(rules []string) ([]approvalRule, error) {
+	var parsed []approvalRule
+	for _, rule := range rules {
+		conditions := approvalRule{}
+		for _, condition := range strings.Split(rule, ",") {
+			kv := strings.SplitN(strings.TrimSpace(condition), "=", 2)
+			if len(kv) != 2 || !isApprovalRuleKey(kv[0]) {
+				return nil, &SesameError{msg: fmt.Sprintf("auto-approve-if [%s]: expected key=glob conditions, keys one of %v", rule, approvalRuleKeys)}
+			}
+			if _, err := path.Match(kv[1], ""); err != nil {
+				return nil, &SesameError{msg: fmt.Sprintf("auto-approve-if [%s]: %v", rule, err)}
+			}
+			conditions[kv[0]] = kv[1]
+		}
+		parsed = append(parsed, conditions)
+	}
+	return parsed, nil
+}
+
+func isApprovalRuleKey(key string) bool {
+	for _, known := range approvalRuleKeys {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule approvalRule) matches(waiting approval) bool {
+	values := map[string]string{
+		"doc":    waiting.DocumentName,
+		"step":   waiting.StepName,
+		"action": waiting.Action,
+		"target": waiting.Target,
+		"name":   waiting.TargetName,
+		"status": waiting.Status,
+	}
+	for key, glob := range rule {
+		if isMatch, _ := path.Match(glob, values[key]); !isMatch {
+			return false
+		}
+	}
+	return true
+}
+
+// findApprovals lists what the record, and its children, wait on.
+func findApprovals(record ExecutionRecord) []approval {
+	var found []approval
+	switch types.AutomationExecutionStatus(record.Status) {
+	case types.AutomationExecutionStatusPendingApproval, types.AutomationExecutionStatusPendingChangeCalendarOverride:
+		found = append(found, newApproval(record, StepRecord{}))
+	}
+	for _, step := range record.Steps {
+		if step.Status == string(types.AutomationExecutionStatusWaiting) && (step.Action == ApprovalActionApprove || step.Action == ApprovalActionPause) {
+			found = append(found, newApproval(record, step))
+		}
+	}
+	for _, child := range record.Children {
+		found = append(found, findApprovals(child)...)
+	}
+	return found
+}
+
+func newApproval(record ExecutionRecord, step StepRecord) approval {
+	waiting := approval{
+		AutomationExecutionId: record.AutomationExecutionId,
+		DocumentName:          record.DocumentName,
+		Status:                record.Status,
+		Target:                record.Target,
+		TargetName:            record.TargetName,
+		StepName:              step.StepName,
+		Action:                step.Action,
+	}
+	if step.Inputs != nil {
+		waiting.Approvers = inputStrings(step.Inputs["Approvers"])
+		waiting.Message = strings.Join(inputStrings(step.Inputs["Message"]), " ")
+	}
+	return waiting
+}
+
+// inputStrings reads a step input, which arrives JSON encoded, as a list of strings.
+func inputStrings(input string) []string {
+	if input == "" {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(input), &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal([]byte(input), &single); err == nil {
+		return []string{single}
+	}
+	return []string{input}
+}
+
+// promptApproval asks what signal, if any, to send.
+func promptApproval(out io.Writer, waiting approval) {
+	if waiting.isPause() {
+		_, _ = fmt.Fprint(out, "[r]esume or [N]o? ")
+	} else {
+		_, _ = fmt.Fprint(out, "[a]pprove, [r]eject or [N]o? ")
+	}
+}
+
+// approvalAnswer is the signal an answer to promptApproval chose, the default answer leaves the execution waiting.
+func approvalAnswer(waiting approval, answer string) (types.SignalType, bool) {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "a", "approve":
+		if !waiting.isPause() {
+			return types.SignalTypeApprove, true
+		}
+	case "r", "reject", "resume":
+		if waiting.isPause() {
+			return types.SignalTypeResume, true
+		}
+		return types.SignalTypeReject, true
+	}
+	return "", false
+}
+
+// approvalDesk handles every approval once, by --auto-approve-if, by asking or by just showing it. The polls only
+// queue what is to be asked, watch asks it so a question doesn't hold up polling, --timeout or Ctrl-C.
+type approvalDesk struct {
+	mu      sync.Mutex
+	rules   []approvalRule
+	handled map[string]bool
+	queued  []approval
+	// ready tells watch there are queued approvals.
+	ready chan struct{}
+	// asking is the approval watch is waiting on an answer for, only watch uses it.
+	asking *approval
+}
+
+func newApprovalDesk() *approvalDesk {
+	return &approvalDesk{handled: map[string]bool{}, ready: make(chan struct{}, 1)}
+}
+
+// handleApprovals shows what the records wait on and sends the signal the rules chose, or queues them for watch to ask
+// the person at the terminal.
+func (trackomate *Trackomate) handleApprovals(records ...ExecutionRecord) {
+	desk := trackomate.approvals
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	for _, record := range records {
+		for _, waiting := range findApprovals(record) {
+			if desk.handled[waiting.key()] {
+				continue
+			}
+			desk.handled[waiting.key()] = true
+			showApproval(progressOut(), waiting)
+			signalType, isSignalled := desk.decide(waiting)
+			if !isSignalled {
+				if isInteractive() {
+					desk.queue(waiting)
+				}
+				continue
+			}
+			if err := trackomate.sendSignal(waiting, signalType); err != nil {
+				// the next poll may offer it again
+				delete(desk.handled, waiting.key())
+				_, _ = fmt.Fprintf(reportOut(), "  REPORT: %s %s failed: %v\n", signalType, waiting.key(), err)
+			}
+		}
+	}
+}
+
+func (desk *approvalDesk) decide(waiting approval) (types.SignalType, bool) {
+	for _, rule := range desk.rules {
+		if rule.matches(waiting) {
+			_, _ = fmt.Fprintf(progressOut(), "  REPORT: auto-approve-if %v matched \n", rule)
+			if waiting.isPause() {
+				return types.SignalTypeResume, true
+			}
+			return types.SignalTypeApprove, true
+		}
+	}
+	return "", false
+}
+
+// queue keeps waiting for watch to ask about, desk.mu is held.
+func (desk *approvalDesk) queue(waiting approval) {
+	desk.queued = append(desk.queued, waiting)
+	select {
+	case desk.ready <- struct{}{}:
+	default:
+	}
+}
+
+// askNextApproval puts the next queued approval to the person at the terminal, unless one is asked already.
+func (trackomate *Trackomate) askNextApproval() {
+	desk := trackomate.approvals
+	if desk.asking != nil {
+		return
+	}
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	if len(desk.queued) == 0 {
+		return
+	}
+	waiting := desk.queued[0]
+	desk.queued = desk.queued[1:]
+	desk.asking = &waiting
+	liveOut.hold()
+	promptApproval(reportOut(), waiting)
+}
+
+// approvalAnswers are the lines typed at the terminal while an approval is asked, nil when none is.
+func (trackomate *Trackomate) approvalAnswers() <-chan string {
+	if trackomate.approvals.asking == nil {
+		return nil
+	}
+	return stdinTerminal.Lines()
+}
+
+// answerApproval sends the signal the answer chose, if any, and asks the next approval. Once stdin closed
+// (isOpen is false) an approval is left waiting like on the default answer.
+func (trackomate *Trackomate) answerApproval(answer string, isOpen bool) {
+	desk := trackomate.approvals
+	waiting := *desk.asking
+	desk.asking = nil
+	liveOut.release()
+	if !isOpen {
+		return
+	}
+	if signalType, isSignalled := approvalAnswer(waiting, answer); isSignalled {
+		if err := trackomate.sendSignal(waiting, signalType); err != nil {
+			// the next poll may offer it again
+			desk.mu.Lock()
+			delete(desk.handled, waiting.key())
+			desk.mu.Unlock()
+			_, _ = fmt.Fprintf(reportOut(), "  REPORT: %s %s failed: %v\n", signalType, waiting.key(), err)
+		}
+	}
+	trackomate.askNextApproval()
+}
+
+func showApproval(out io.Writer, waiting approval) {
+	what := waiting.Status
+	if waiting.StepName != "" {
+		what = fmt.Sprintf("step %s (%s)", waiting.StepName, waiting.Action)
+	}
+	_, _ = fmt.Fprintf(out, "  WAITING: [%s] %s[%s] %s is waiting on %s\n", waiting.DocumentName, waiting.TargetName, waiting.Target, waiting.AutomationExecutionId, what)
+	if len(waiting.Approvers) > 0 {
+		approvers := append([]string{}, waiting.Approvers...)
+		sort.Strings(approvers)
+		_, _ = fmt.Fprintf(out, "  WAITING: approvers: %s\n", strings.Join(approvers, ", "))
+	}
+	if waiting.Message != "" {
+		_, _ = fmt.Fprintf(out, "  WAITING: message: %s\n", waiting.Message)
+	}
+}
+
+func (trackomate *Trackomate) sendSignal(waiting approval, signalType types.SignalType) error {
+	input := ssm.SendAutomationSignalInput{
+		AutomationExecutionId: aws.String(waiting.AutomationExecutionId),
+		SignalType:            signalType,
+	}
+	if signalType == types.SignalTypeResume {
+		input.Payload = map[string][]string{"StepName": {waiting.StepName}}
+	} else {
+		input.Payload = map[string][]string{"Comment": {fmt.Sprintf("%s by sesame trackomate", signalType)}}
+	}
+	_, err := trackomate.svc.SendAutomationSignal(context.Background(), &input)
+	if err == nil {
+		_, _ = fmt.Fprintf(progressOut(), "  REPORT: sent %s to %s \n", signalType, waiting.key())
+	}
+	return err
+}
+
+// handleParentApprovals looks up which of the parent's own steps wait, the parent's steps aren't otherwise tracked.
+func (trackomate *Trackomate) handleParentApprovals(item types.AutomationExecutionMetadata) {
+	parent, _ := trackomate.records()
+	if item.AutomationExecutionStatus == types.AutomationExecutionStatusWaiting {
+		steps, err := trackomate.waitingSteps(parent.AutomationExecutionId)
+		if err != nil {
+			trackomate.skipPoll(err)
+			return
+		}
+		parent.Steps = steps
+	}
+	trackomate.handleApprovals(parent)
+}
+
+// waitingSteps are the steps of an execution Waiting on someone, with the inputs naming its approvers.
+func (trackomate *Trackomate) waitingSteps(executionId string) ([]StepRecord, error) {
+	steps, err := describeAllStepExecutions(context.Background(), trackomate.svc, &ssm.DescribeAutomationStepExecutionsInput{
+		AutomationExecutionId: aws.String(executionId),
+		Filters: []types.StepExecutionFilter{{
+			Key:    types.StepExecutionFilterKeyStepExecutionStatus,
+			Values: []string{string(types.AutomationExecutionStatusWaiting)},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	records := make([]StepRecord, 0, len(steps))
+	for _, step := range steps {
+		records = append(records, StepRecord{
+			StepName:        aws.ToString(step.StepName),
+			StepExecutionId: aws.ToString(step.StepExecutionId),
+			Action:          aws.ToString(step.Action),
+			Status:          string(step.StepStatus),
+			Inputs:          step.Inputs,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestFindApprovals(t *testing.T) {
+	parent := ExecutionRecord{AutomationExecutionId: "parent-1", DocumentName: "Change", Status: "PendingApproval",
+		Children: []ExecutionRecord{
+			{AutomationExecutionId: "child-1", DocumentName: "Patch", Status: "Waiting", Target: "i-1", TargetName: "web",
+				Steps: []StepRecord{
+					{StepName: "backup", Action: "aws:runCommand", Status: "Success"},
+					{StepName: "approveProd", Action: ApprovalActionApprove, Status: "Waiting", Inputs: map[string]string{
+						"Approvers": `["arn:aws:iam::123456789012:role/Ops","arn:aws:iam::123456789012:user/alice"]`,
+						"Message":   `"Patch prod web?"`,
+					}},
+				},
+				Children: []ExecutionRecord{{AutomationExecutionId: "grandchild-1", DocumentName: "Reboot", Status: "Waiting",
+					Steps: []StepRecord{{StepName: "hold", Action: ApprovalActionPause, Status: "Waiting"}}}}},
+			{AutomationExecutionId: "child-2", DocumentName: "Patch", Status: "PendingChangeCalendarOverride", Target: "i-2"},
+			{AutomationExecutionId: "child-3", DocumentName: "Patch", Status: "Success", Target: "i-3",
+				Steps: []StepRecord{{StepName: "approveProd", Action: ApprovalActionApprove, Status: "Approved"}}},
+		}}
+	var keys []string
+	for _, waiting := range findApprovals(parent) {
+		keys = append(keys, waiting.key())
+	}
+	expected := []string{"parent-1/", "child-1/approveProd", "grandchild-1/hold", "child-2/"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	approve := findApprovals(parent.Children[0])[0]
+	if !reflect.DeepEqual(approve.Approvers, []string{"arn:aws:iam::123456789012:role/Ops", "arn:aws:iam::123456789012:user/alice"}) || approve.Message != "Patch prod web?" {
+		t.Errorf("expected approvers and message from the step inputs, got %+v", approve)
+	}
+	var out bytes.Buffer
+	showApproval(&out, approve)
+	if !strings.Contains(out.String(), "waiting on step approveProd (aws:approve)") || !strings.Contains(out.String(), "message: Patch prod web?") {
+		t.Errorf("unexpected approval shown %q", out.String())
+	}
+}
+
+func TestApprovalRules(t *testing.T) {
+	rules, err := parseApprovalRules([]string{"doc=Patch*,step=approve*", "action=aws:pause"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		waiting   approval
+		isMatched bool
+	}{
+		{approval{DocumentName: "PatchLinux", StepName: "approveProd", Action: ApprovalActionApprove}, true},
+		{approval{DocumentName: "Reboot", StepName: "approveProd", Action: ApprovalActionApprove}, false},
+		{approval{DocumentName: "PatchLinux", Status: "PendingApproval"}, false},
+		{approval{DocumentName: "Reboot", StepName: "hold", Action: ApprovalActionPause}, true},
+	}
+	for _, c := range cases {
+		isMatched := rules[0].matches(c.waiting) || rules[1].matches(c.waiting)
+		if isMatched != c.isMatched {
+			t.Errorf("[%+v]: expected matched=%v", c.waiting, c.isMatched)
+		}
+	}
+	for _, bad := range []string{"doc", "owner=bob", "doc=[", "doc=Patch*,"} {
+		if _, err := parseApprovalRules([]string{bad}); err == nil {
+			t.Errorf("[%s]: expected an invalid rule", bad)
+		}
+	}
+}
+
+func TestApprovalAnswer(t *testing.T) {
+	approve := approval{StepName: "approveProd", Action: ApprovalActionApprove}
+	pause := approval{StepName: "hold", Action: ApprovalActionPause}
+	cases := []struct {
+		waiting     approval
+		answer      string
+		signalType  types.SignalType
+		isSignalled bool
+	}{
+		{approve, "a\n", types.SignalTypeApprove, true},
+		{approve, "reject\n", types.SignalTypeReject, true},
+		{approve, "\n", "", false},
+		{pause, "r\n", types.SignalTypeResume, true},
+		{pause, "a\n", "", false},
+		{approval{Status: "PendingApproval"}, "Approve\n", types.SignalTypeApprove, true},
+	}
+	for _, c := range cases {
+		signalType, isSignalled := approvalAnswer(c.waiting, c.answer)
+		if signalType != c.signalType || isSignalled != c.isSignalled {
+			t.Errorf("[%s %q]: expected %q %v, got %q %v", c.waiting.key(), c.answer, c.signalType, c.isSignalled, signalType, isSignalled)
+		}
+	}
+}
+
+func TestApprovalQueue(t *testing.T) {
+	trackomate := newTrackomate("", -1)
+	desk := trackomate.approvals
+	desk.queue(approval{AutomationExecutionId: "child-1", StepName: "approveProd", Action: ApprovalActionApprove})
+	desk.queue(approval{AutomationExecutionId: "child-2", StepName: "hold", Action: ApprovalActionPause})
+	if trackomate.approvalAnswers() != nil {
+		t.Fatalf("expected no answers read before anything is asked")
+	}
+	<-desk.ready
+	trackomate.askNextApproval()
+	trackomate.askNextApproval()
+	if desk.asking == nil || desk.asking.AutomationExecutionId != "child-1" || len(desk.queued) != 1 {
+		t.Fatalf("expected child-1 asked and child-2 queued, got %+v %v", desk.asking, desk.queued)
+	}
+	// the default answer sends nothing and asks the next one
+	trackomate.answerApproval("\n", true)
+	if desk.asking == nil || desk.asking.AutomationExecutionId != "child-2" || len(desk.queued) != 0 {
+		t.Fatalf("expected child-2 asked, got %+v %v", desk.asking, desk.queued)
+	}
+	trackomate.answerApproval("", false)
+	if desk.asking != nil {
+		t.Errorf("expected nothing asked once stdin closed, got %+v", desk.asking)
+	}
+}
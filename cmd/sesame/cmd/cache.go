@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// runCache keeps what a run would otherwise fetch on every poll: the tags of each target, which don't change while
+// trackomate watches, the steps of each child, until its status or current step moved on, and the output of every
+// completed plugin.
+type runCache struct {
+	mu      sync.Mutex
+	tags    map[string]map[string]string
+	steps   map[string]cachedSteps
+	outputs map[string]CommandRecord
+}
+
+type cachedSteps struct {
+	fingerprint string
+	steps       []StepRecord
+}
+
+func newRunCache() *runCache {
+	return &runCache{tags: map[string]map[string]string{}, steps: map[string]cachedSteps{}, outputs: map[string]CommandRecord{}}
+}
+
+// instanceTags returns the target's tags, fetching them the first time only, a failed fetch is tried again next time.
+func (cache *runCache) instanceTags(target string, fetch func() (map[string]string, error)) (map[string]string, error) {
+	cache.mu.Lock()
+	tags, ok := cache.tags[target]
+	cache.mu.Unlock()
+	if ok {
+		return tags, nil
+	}
+	tags, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	cache.mu.Lock()
+	cache.tags[target] = tags
+	cache.mu.Unlock()
+	return tags, nil
+}
+
+// stepsFingerprint changes whenever the execution's steps may have, its status or the step it is on moved.
+func stepsFingerprint(item types.AutomationExecutionMetadata) string {
+	return fmt.Sprintf("%s|%s|%s", item.AutomationExecutionStatus, aws.ToString(item.CurrentStepName), aws.ToString(item.CurrentAction))
+}
+
+func (cache *runCache) cachedSteps(executionId string, fingerprint string) ([]StepRecord, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cached, ok := cache.steps[executionId]
+	if !ok || cached.fingerprint != fingerprint {
+		return nil, false
+	}
+	return cached.steps, true
+}
+
+func (cache *runCache) putSteps(executionId string, fingerprint string, steps []StepRecord) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.steps[executionId] = cachedSteps{fingerprint: fingerprint, steps: steps}
+}
+
+func (cache *runCache) cachedOutput(key string) (CommandRecord, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	command, ok := cache.outputs[key]
+	return command, ok
+}
+
+func (cache *runCache) putOutput(key string, command CommandRecord) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.outputs[key] = command
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestRunCacheInstanceTags(t *testing.T) {
+	cache := newRunCache()
+	fetches := 0
+	fail := true
+	fetch := func() (map[string]string, error) {
+		fetches++
+		if fail {
+			return nil, errors.New("throttled")
+		}
+		return map[string]string{"Name": "web"}, nil
+	}
+	if _, err := cache.instanceTags("i-1", fetch); err == nil {
+		t.Fatalf("expected the failed fetch's error")
+	}
+	fail = false
+	for i := 0; i < 3; i++ {
+		tags, err := cache.instanceTags("i-1", fetch)
+		if err != nil || tags["Name"] != "web" {
+			t.Fatalf("expected the Name tag, got %v %v", tags, err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected a failed fetch to be tried again and a good one kept, got %d fetches", fetches)
+	}
+}
+
+func TestRunCacheSteps(t *testing.T) {
+	cache := newRunCache()
+	running := types.AutomationExecutionMetadata{AutomationExecutionStatus: types.AutomationExecutionStatusInprogress, CurrentStepName: aws.String("install"), CurrentAction: aws.String("aws:runCommand")}
+	steps := []StepRecord{{StepName: "install", Status: "InProgress"}}
+	cache.putSteps("child-1", stepsFingerprint(running), steps)
+
+	if cached, ok := cache.cachedSteps("child-1", stepsFingerprint(running)); !ok || !reflect.DeepEqual(cached, steps) {
+		t.Errorf("expected the steps while nothing changed, got %v %v", cached, ok)
+	}
+	nextStep := running
+	nextStep.CurrentStepName = aws.String("reboot")
+	done := running
+	done.AutomationExecutionStatus = types.AutomationExecutionStatusSuccess
+	for _, changed := range []types.AutomationExecutionMetadata{nextStep, done} {
+		if _, ok := cache.cachedSteps("child-1", stepsFingerprint(changed)); ok {
+			t.Errorf("expected a refetch once %s changed", stepsFingerprint(changed))
+		}
+	}
+	if _, ok := cache.cachedSteps("child-2", stepsFingerprint(running)); ok {
+		t.Errorf("expected nothing cached for another child")
+	}
+}
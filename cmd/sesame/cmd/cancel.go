@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const CancelOnExitAsk = "ask"
+const CancelOnExitNo = "no"
+const CancelOnExitCancel = "cancel"
+const CancelOnExitComplete = "complete"
+
+var cancelOnExitActions = []string{CancelOnExitAsk, CancelOnExitNo, CancelOnExitCancel, CancelOnExitComplete}
+
+var cancelOnExit string
+
+func validateCancelOnExit(action string) error {
+	for _, known := range cancelOnExitActions {
+		if action == known {
+			return nil
+		}
+	}
+	return &SesameError{msg: fmt.Sprintf("unknown cancel-on-exit [%s], expected one of %v", action, cancelOnExitActions)}
+}
+
+// isInteractive is true when a person at a terminal can answer a question on stdin.
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminal reads stdin a line at a time in the background for every question trackomate asks, a question given
+// up on at --timeout or Ctrl-C leaves no reader behind to swallow the answer to the next one.
+type terminal struct {
+	in    io.Reader
+	once  sync.Once
+	lines chan string
+	// rest is what Read didn't fit of the last line.
+	rest string
+}
+
+var stdinTerminal = newTerminal(os.Stdin)
+
+func newTerminal(in io.Reader) *terminal {
+	return &terminal{in: in, lines: make(chan string)}
+}
+
+// Lines are the lines typed at the terminal, closed once stdin is.
+func (term *terminal) Lines() <-chan string {
+	term.once.Do(func() {
+		go func() {
+			reader := bufio.NewReader(term.in)
+			for {
+				line, err := reader.ReadString('\n')
+				if line != "" {
+					term.lines <- line
+				}
+				if err != nil {
+					close(term.lines)
+					return
+				}
+			}
+		}()
+	})
+	return term.lines
+}
+
+// Read hands out one line at a time, io.EOF once stdin closed.
+func (term *terminal) Read(p []byte) (int, error) {
+	if term.rest == "" {
+		line, isOpen := <-term.Lines()
+		if !isOpen {
+			return 0, io.EOF
+		}
+		term.rest = line
+	}
+	n := copy(p, term.rest)
+	term.rest = term.rest[n:]
+	return n, nil
+}
+
+// askStopType asks whether to stop the execution, the default answer leaves it running.
+func askStopType(in io.Reader, out io.Writer, question string) (types.StopType, bool) {
+	_, _ = fmt.Fprintf(out, "%s [c]ancel, c[o]mplete or [N]o? ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "c", "cancel":
+		return types.StopTypeCancel, true
+	case "o", "complete":
+		return types.StopTypeComplete, true
+	}
+	return "", false
+}
+
+// stopTypeOnExit decides, from --cancel-on-exit or by asking, whether and how to stop an execution trackomate
+// is about to stop watching.
+func (trackomate *Trackomate) stopTypeOnExit(reason string) (types.StopType, bool) {
+	switch trackomate.cancelOnExit {
+	case CancelOnExitCancel:
+		return types.StopTypeCancel, true
+	case CancelOnExitComplete:
+		return types.StopTypeComplete, true
+	case CancelOnExitAsk:
+		if isInteractive() {
+			liveOut.hold()
+			defer liveOut.release()
+			return askStopType(stdinTerminal, reportOut(), fmt.Sprintf("%s, stop %s?", reason, trackomate.trackedId()))
+		}
+	}
+	return "", false
+}
+
+// stopOnExit stops the execution when --cancel-on-exit, or the person asked, says so, and is true when it did.
+func (trackomate *Trackomate) stopOnExit(reason string) bool {
+	stopType, isStopping := trackomate.stopTypeOnExit(reason)
+	if !isStopping {
+		_, _ = fmt.Fprintf(progressOut(), "  REPORT: %s, leaving %s running \n", reason, trackomate.trackedId())
+		return false
+	}
+	trackomate.stopExecution(stopType)
+	return true
+}
+
+// stopExecution stops the tracked execution, tracking goes on until it reached a terminal state.
+func (trackomate *Trackomate) stopExecution(stopType types.StopType) {
+	_, _ = fmt.Fprintf(progressOut(), "  REPORT: Stopping %s with %s \n", trackomate.trackedId(), stopType)
+	exitOnError(trackomate.stop(stopType))
+	trackomate.isStopping = true
+}
+
+// untilStopped reads the reports of a stopped execution until it is DONE, a second interrupt leaves it stopping.
+func (trackomate *Trackomate) untilStopped(interrupts <-chan os.Signal) {
+	for trackomate.polling.pending() > 0 {
+		select {
+		case report := <-*trackomate.reportChan:
+			_, _ = fmt.Fprintf(progressOut(), "  REPORT: %s \n", report)
+			if report == "DONE" {
+				return
+			}
+		case <-interrupts:
+			_, _ = fmt.Fprintf(progressOut(), "  REPORT: Interrupted again, not waiting for %s to stop \n", trackomate.trackedId())
+			return
+		}
+	}
+}
+
+func (trackomate *Trackomate) trackedId() string {
+	if trackomate.commandId != "" {
+		return "command " + trackomate.commandId
+	}
+	return "automation " + trackomate.automationExecutionId
+}
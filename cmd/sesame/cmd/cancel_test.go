@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestAskStopType(t *testing.T) {
+	cases := []struct {
+		answer     string
+		stopType   types.StopType
+		isStopping bool
+	}{
+		{"c\n", types.StopTypeCancel, true},
+		{"Cancel\n", types.StopTypeCancel, true},
+		{"o\n", types.StopTypeComplete, true},
+		{" complete \n", types.StopTypeComplete, true},
+		{"\n", "", false},
+		{"n\n", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		stopType, isStopping := askStopType(strings.NewReader(c.answer), &out, "Interrupted, stop automation abc?")
+		if stopType != c.stopType || isStopping != c.isStopping {
+			t.Errorf("[%q]: expected %q %v, got %q %v", c.answer, c.stopType, c.isStopping, stopType, isStopping)
+		}
+		if !strings.HasPrefix(out.String(), "Interrupted, stop automation abc?") {
+			t.Errorf("[%q]: expected the question, got %q", c.answer, out.String())
+		}
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	term := newTerminal(strings.NewReader("c\n" + long + "\nn"))
+	if stopType, isStopping := askStopType(term, &bytes.Buffer{}, "stop?"); stopType != types.StopTypeCancel || !isStopping {
+		t.Errorf("expected the first line to cancel, got %q %v", stopType, isStopping)
+	}
+	// a question given up on leaves its answer to the next one
+	if line := <-term.Lines(); line != long+"\n" {
+		t.Errorf("expected the whole long line, got %d characters", len(line))
+	}
+	if stopType, isStopping := askStopType(term, &bytes.Buffer{}, "stop?"); isStopping {
+		t.Errorf("expected the last line to leave it running, got %q", stopType)
+	}
+	if _, isStopping := askStopType(term, &bytes.Buffer{}, "stop?"); isStopping {
+		t.Errorf("expected no answer once stdin closed")
+	}
+}
+
+func TestStopTypeOnExit(t *testing.T) {
+	cases := []struct {
+		cancelOnExit string
+		stopType     types.StopType
+		isStopping   bool
+	}{
+		{CancelOnExitCancel, types.StopTypeCancel, true},
+		{CancelOnExitComplete, types.StopTypeComplete, true},
+		{CancelOnExitNo, "", false},
+	}
+	for _, c := range cases {
+		trackomate := newTrackomate("abc", -1)
+		trackomate.cancelOnExit = c.cancelOnExit
+		stopType, isStopping := trackomate.stopTypeOnExit("Interrupted")
+		if stopType != c.stopType || isStopping != c.isStopping {
+			t.Errorf("[%s]: expected %q %v, got %q %v", c.cancelOnExit, c.stopType, c.isStopping, stopType, isStopping)
+		}
+	}
+	if err := validateCancelOnExit("explode"); err == nil {
+		t.Errorf("expected an unknown cancel-on-exit to be invalid")
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Run Command has its own statuses, and StatusDetails that say why an invocation ended
+// - From services/ssm/types/enums.go and the ListCommandInvocations docs
+//             /- Succeeded =====================================
+//            /           - Success
+// completed =
+//            \- Failed    ======================================
+//                        - Failed, TimedOut, Cancelled (Canceled in StatusDetails)
+//                        - DeliveryTimedOut, ExecutionTimedOut, Undeliverable, Terminated
+//                        - InvalidPlatform, AccessDenied, NoInstancesInTag
+//                        - and anything AWS adds later
+//
+// pending =   ======================
+//           - Pending, InProgress, Delayed, Cancelling
+//
+// StatusDetails spells them with spaces, e.g. "In Progress" or "Delivery Timed Out".
+
+// isCompletedCommandStatus sorts a command, invocation or plugin Status, or StatusDetails, like isCompletedStatus does automations.
+func isCompletedCommandStatus(status string) (bool, bool) {
+	switch strings.ReplaceAll(status, " ", "") {
+	case string(types.CommandStatusSuccess):
+		return true, true
+	case string(types.CommandStatusPending), string(types.CommandStatusInProgress), string(types.CommandInvocationStatusDelayed), string(types.CommandStatusCancelling):
+		return false, false
+	}
+	return true, false
+}
+
+// invocationStatus prefers StatusDetails, e.g. Delivery Timed Out or Undeliverable, over the coarser Status.
+func invocationStatus(invocation types.CommandInvocation) string {
+	if invocation.StatusDetails != nil && *invocation.StatusDetails != "" {
+		return *invocation.StatusDetails
+	}
+	return string(invocation.Status)
+}
+
+func (trackomate *Trackomate) thingDoCommand() {
+	if !trackomate.checkCommand() {
+		trackomate.scheduleCommand()
+		trackomate.watch()
+	}
+	trackomate.finish()
+}
+
+func (trackomate *Trackomate) scheduleCommand() {
+	trackomate.schedulePoll(newBackoff(trackomate.pollMin, trackomate.pollMax), func() bool {
+		isDone := trackomate.checkCommand()
+		if isDone {
+			*trackomate.reportChan <- "DONE"
+		} else {
+			*trackomate.reportChan <- "command ran"
+		}
+		return isDone
+	})
+}
+
+// checkCommand reports the command and its invocation on every target, it is true once they all completed.
+func (trackomate *Trackomate) checkCommand() bool {
+	res, err := trackomate.svc.ListCommands(context.Background(), &ssm.ListCommandsInput{CommandId: &trackomate.commandId})
+	if err != nil {
+		trackomate.skipPoll(err)
+		return false
+	}
+	if len(res.Commands) == 0 {
+		exitOnError(&SesameError{msg: "No results for command id.", code: ExitNotFound})
+	}
+	command := res.Commands[0]
+	status := string(command.Status)
+	if command.StatusDetails != nil && *command.StatusDetails != "" {
+		status = *command.StatusDetails
+	}
+	isCommandCompleted, isCommandSuccess := isCompletedCommandStatus(status)
+	counts := fmt.Sprintf("targets=%d completed=%d errors=%d", command.TargetCount, command.CompletedCount, command.ErrorCount)
+	trackomate.progress.printf(trackomate.commandId, status+" "+counts, "Command: %s [%s] %s\n", colorStatus(status, isCommandCompleted, isCommandSuccess), aws.ToString(command.DocumentName), counts)
+	parent := ExecutionRecord{
+		CommandId:    trackomate.commandId,
+		DocumentName: aws.ToString(command.DocumentName),
+		Status:       status,
+	}
+	trackomate.setParent(parent)
+	trackomate.events.parent(parent)
+
+	invocations, err := listAllCommandInvocations(context.Background(), trackomate.svc, &ssm.ListCommandInvocationsInput{
+		CommandId: &trackomate.commandId,
+		Details:   true,
+	})
+	if err != nil {
+		trackomate.skipPoll(err)
+		return false
+	}
+	execs := executions{allComplete: isCommandCompleted}
+	var children []ExecutionRecord
+	for _, invocation := range invocations {
+		target := aws.ToString(invocation.InstanceId)
+		name := trackomate.targetName(target)
+		status := invocationStatus(invocation)
+		isCompleted, isSuccess := isCompletedCommandStatus(status)
+		switch {
+		case !isCompleted:
+			execs.allComplete = false
+			execs.incomplete = append(execs.incomplete, target)
+		case isSuccess:
+			execs.succeeded = append(execs.succeeded, target)
+		default:
+			execs.failed = append(execs.failed, target)
+		}
+		record := ExecutionRecord{
+			CommandId:          trackomate.commandId,
+			DocumentName:       aws.ToString(invocation.DocumentName),
+			Status:             status,
+			Target:             target,
+			TargetName:         name,
+			ExecutionStartTime: invocation.RequestedDateTime,
+		}
+		trackomate.progress.printf(record.key(), status, " TARGET: what [%s]:[%s] %s[%s]\n", record.DocumentName, colorStatus(status, isCompleted, isSuccess), name, target)
+		for _, plugin := range invocation.CommandPlugins {
+			command := trackomate.newCommandRecord(trackomate.commandId, invocation, plugin)
+			trackomate.progress.output(" TARGET", command)
+			record.Commands = append(record.Commands, command)
+		}
+		trackomate.events.child(record)
+		children = append(children, record)
+	}
+	trackomate.setChildren(children)
+	trackomate.progress.redraw(parent, children)
+
+	return execs.allComplete
+}
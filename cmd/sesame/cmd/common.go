@@ -3,12 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/spf13/cobra"
 	"os"
 	"runtime/debug"
+	"strings"
 )
 
 func ValidateArgsFunc() func(cmd *cobra.Command, args []string) error {
@@ -26,13 +30,15 @@ func exitOnError(err error) {
 		if err != nil {
 			panic(err)
 		}
-		os.Exit(1)
+		os.Exit(exitCodeOf(err))
 	}
 }
 
 type SesameError struct {
 	msg         string
 	reportStack bool
+	// code is the exit code, ExitInternal when not set
+	code int
 }
 
 func (m *SesameError) Error() string {
@@ -42,16 +48,59 @@ func (m *SesameError) Error() string {
 	return m.msg
 }
 
+// parseTarget reads a target expression, see ssmsearch.Expression. The Key:Value form --filterTag
+// always took is still read as Key=Value.
+func parseTarget(target string) (*ssmsearch.Expression, error) {
+	expression, err := ssmsearch.ParseExpression(target)
+	if err != nil && !strings.ContainsAny(target, "=()") && strings.Contains(target, ":") {
+		parts := strings.SplitN(target, ":", 2)
+		return ssmsearch.TagEquals(parts[0], parts[1]), nil
+	}
+	return expression, err
+}
+
 type SSMCommand struct {
-	svc    *ssm.Client
-	svcEc2 *ec2.Client
+	svc       *ssm.Client
+	svcEc2    *ec2.Client
+	region    string
+	scope     Scope
+	awsConfig aws.Config
 }
 
 func (ssmCommand *SSMCommand) conf() {
-	conf, err := config.LoadDefaultConfig(context.Background())
-	exitOnError(err)
+	ssmCommand.confScope(Scope{})
+}
+
+// confScope is conf for a --profiles/--regions pair, the zero Scope is the default config.
+func (ssmCommand *SSMCommand) confScope(scope Scope) {
+	exitOnError(ssmCommand.load(scope))
+}
+
+func (ssmCommand *SSMCommand) load(scope Scope) error {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRetryer(newRetryer),
+		config.WithAPIOptions([]func(*middleware.Stack) error{addRateLimit}),
+	}
+	if scope.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(scope.Profile))
+	}
+	if scope.Region != "" {
+		opts = append(opts, config.WithRegion(scope.Region))
+	}
+	conf, err := config.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
 	ssmCommand.svc = ssm.NewFromConfig(conf)
 	ssmCommand.svcEc2 = ec2.NewFromConfig(conf)
+	ssmCommand.region = conf.Region
+	ssmCommand.scope = scope
+	ssmCommand.awsConfig = conf
+	return nil
+}
+
+func (ssmCommand *SSMCommand) searcher() *ssmsearch.Searcher {
+	return ssmsearch.NewSearcher(ssmCommand.svc, ssmCommand.svcEc2)
 }
 
 func (ssmCommand *SSMCommand) thingDo() {
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Heraclitus/sesame/cmd/sesame/automation"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// completionCacheMaxAge keeps repeated tab presses from calling AWS while staying fresh enough to trust.
+const completionCacheMaxAge = 5 * time.Minute
+
+type completionCache struct {
+	Created     time.Time
+	Completions []string
+}
+
+// cachedCompletions returns the fresh on-disk completions for name, or fetches and stores them.
+// Completions are "value\tdescription" as cobra expects.
+func cachedCompletions(name string, fetch func(ctx context.Context, ssmCommand *SSMCommand) ([]string, error)) ([]string, error) {
+	ssmCommand := &SSMCommand{}
+	if err := ssmCommand.load(Scope{}); err != nil {
+		return nil, err
+	}
+	p, err := ssmCommand.cachePath("completion-" + name)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := completionCache{}
+	if b, err := ioutil.ReadFile(p); err == nil && json.Unmarshal(b, &cache) == nil && time.Since(cache.Created) < completionCacheMaxAge {
+		return cache.Completions, nil
+	}
+
+	completions, err := fetch(context.Background(), ssmCommand)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(completionCache{Created: time.Now(), Completions: completions})
+	if err == nil && os.MkdirAll(filepath.Dir(p), 0700) == nil {
+		_ = ioutil.WriteFile(p, b, 0600)
+	}
+	return completions, nil
+}
+
+// nicknameCompletions are the --tag values of the local instance index plus the alias names. The index
+// is already an on-disk cache of the fleet's tags, it is read however old it is and never built here, a tab
+// press shouldn't list the whole fleet.
+func nicknameCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	ssmCommand := &SSMCommand{}
+	index := &InstanceIndex{}
+	if err := ssmCommand.load(Scope{}); err == nil {
+		if p, err := ssmCommand.cachePath("index"); err == nil {
+			if existing, err := readIndex(p); err == nil {
+				index = existing
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	var completions []string
+	for _, instance := range index.Instances {
+		if v, ok := instance.Tags[tag]; ok && !seen[v] {
+			seen[v] = true
+			completions = append(completions, fmt.Sprintf("%s\t%s", v, instance.InstanceId))
+		}
+	}
+	for _, name := range loadAliases().Names() {
+		if !seen[name] {
+			seen[name] = true
+			completions = append(completions, fmt.Sprintf("%s\talias", name))
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// executionCompletions are the most recent top level automation executions with their document names.
+func executionCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	completions, err := cachedCompletions("executions", recentExecutions)
+	if err != nil {
+		cobra.CompErrorln(err.Error())
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func recentExecutions(ctx context.Context, ssmCommand *SSMCommand) ([]string, error) {
+	maxRes := maxRecords
+	res, err := ssmCommand.svc.DescribeAutomationExecutions(ctx, &ssm.DescribeAutomationExecutionsInput{MaxResults: &maxRes})
+	if err != nil {
+		return nil, err
+	}
+	var completions []string
+	for _, item := range res.AutomationExecutionMetadataList {
+		if item.ParentAutomationExecutionId != nil {
+			continue
+		}
+		completions = append(completions, fmt.Sprintf("%s\t%s %s", aws.ToString(item.AutomationExecutionId), aws.ToString(item.DocumentName), item.AutomationExecutionStatus))
+	}
+	return completions, nil
+}
+
+// libraryCompletions are the automation libraries found in --libsearchpath, read fresh since they're local.
+func libraryCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	for _, lib := range automation.GetListOfAutomationLibraries(ioutil.Discard, automationLibSearchPath) {
+		completions = append(completions, fmt.Sprintf("%s\t%s", lib.Metadata.Name, lib.Metadata.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func directoryCompletions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+const EventsNdjson = "ndjson"
+
+const EventParentStatus = "parent.status"
+const EventChildStatus = "child.status"
+const EventStepStarted = "step.started"
+const EventStepFinished = "step.finished"
+const EventCommandOutput = "command.output"
+const EventSummary = "summary"
+
+// Event is one state transition of a tracked execution, trackomate --events ndjson writes one per line.
+type Event struct {
+	Time                  time.Time
+	Type                  string
+	AutomationExecutionId string
+	ParentExecutionId     string `json:",omitempty"`
+	DocumentName          string `json:",omitempty"`
+	Target                string `json:",omitempty"`
+	TargetName            string `json:",omitempty"`
+	StepName              string `json:",omitempty"`
+	StepExecutionId       string `json:",omitempty"`
+	CommandId             string `json:",omitempty"`
+	InstanceId            string `json:",omitempty"`
+	PluginName            string `json:",omitempty"`
+	Status                string
+	PreviousStatus        string `json:",omitempty"`
+	FailureMessage        string `json:",omitempty"`
+	Output                string `json:",omitempty"`
+	// Succeeded, Failed and Pending count the children, Retries the retried AWS calls and SkippedPolls the polls
+	// given up on after transient errors, they are only set on the summary.
+	Succeeded    *int `json:",omitempty"`
+	Failed       *int `json:",omitempty"`
+	Pending      *int `json:",omitempty"`
+	Retries      *int `json:",omitempty"`
+	SkippedPolls *int `json:",omitempty"`
+}
+
+// eventStream writes an Event only when the status of what it describes changed since the last poll, or for a
+// command when its output grew. A nil eventStream writes nothing.
+type eventStream struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	now     func() time.Time
+	seen    map[string]string
+	outputs map[string]string
+}
+
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w), now: time.Now, seen: make(map[string]string), outputs: make(map[string]string)}
+}
+
+// transition writes event when key moved to a new status, it reports whether it did.
+func (events *eventStream) transition(key string, event Event) bool {
+	if events == nil {
+		return false
+	}
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	previous, ok := events.seen[key]
+	if ok && previous == event.Status {
+		return false
+	}
+	events.seen[key] = event.Status
+	event.PreviousStatus = previous
+	events.write(event)
+	return true
+}
+
+func (events *eventStream) write(event Event) {
+	event.Time = events.now().UTC()
+	exitOnError(events.enc.Encode(event))
+}
+
+func (events *eventStream) parent(record ExecutionRecord) {
+	events.transition(record.key(), Event{
+		Type:                  EventParentStatus,
+		AutomationExecutionId: record.AutomationExecutionId,
+		CommandId:             record.CommandId,
+		DocumentName:          record.DocumentName,
+		Status:                record.Status,
+		FailureMessage:        record.FailureMessage,
+	})
+}
+
+// child writes the status of a child execution, then of its steps and of the commands they sent,
+// or of a Run Command invocation and its plugins.
+func (events *eventStream) child(record ExecutionRecord) {
+	if events == nil {
+		return
+	}
+	events.transition(record.key(), Event{
+		Type:                  EventChildStatus,
+		AutomationExecutionId: record.AutomationExecutionId,
+		CommandId:             record.CommandId,
+		ParentExecutionId:     record.ParentExecutionId,
+		DocumentName:          record.DocumentName,
+		Target:                record.Target,
+		TargetName:            record.TargetName,
+		Status:                record.Status,
+		FailureMessage:        record.FailureMessage,
+	})
+	for _, command := range record.Commands {
+		events.command(record, StepRecord{}, command)
+	}
+	for _, step := range record.Steps {
+		event := Event{
+			AutomationExecutionId: record.AutomationExecutionId,
+			ParentExecutionId:     record.ParentExecutionId,
+			Target:                record.Target,
+			TargetName:            record.TargetName,
+			StepName:              step.StepName,
+			StepExecutionId:       step.StepExecutionId,
+			Status:                step.Status,
+		}
+		if isStepStarted(step.Status) {
+			event.Type = EventStepStarted
+			event.Status = string(types.AutomationExecutionStatusInprogress)
+			events.transition(step.StepExecutionId+"/started", event)
+		}
+		if isStepFinished(step.Status) {
+			event.Type = EventStepFinished
+			event.Status = step.Status
+			event.FailureMessage = step.FailureMessage
+			events.transition(step.StepExecutionId+"/finished", event)
+		}
+		for _, command := range step.Commands {
+			events.command(record, step, command)
+		}
+	}
+}
+
+// command writes a command.output when the status of a plugin changed or its output grew, with only the output
+// not written yet.
+func (events *eventStream) command(record ExecutionRecord, step StepRecord, command CommandRecord) {
+	key := command.key()
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	previous, ok := events.seen[key]
+	previousOutput := events.outputs[key]
+	if ok && previous == command.Status && previousOutput == command.Output {
+		return
+	}
+	events.seen[key] = command.Status
+	events.outputs[key] = command.Output
+	if previous == command.Status {
+		previous = ""
+	}
+	events.write(Event{
+		Type:                  EventCommandOutput,
+		AutomationExecutionId: record.AutomationExecutionId,
+		ParentExecutionId:     record.ParentExecutionId,
+		Target:                record.Target,
+		TargetName:            record.TargetName,
+		StepName:              step.StepName,
+		StepExecutionId:       step.StepExecutionId,
+		CommandId:             command.CommandId,
+		InstanceId:            command.InstanceId,
+		PluginName:            command.PluginName,
+		Status:                command.Status,
+		PreviousStatus:        previous,
+		Output:                newOutput(previousOutput, command.Output),
+	})
+}
+
+// summary writes the final status of the parent, how its children ended and what it took to get there.
+func (events *eventStream) summary(parent ExecutionRecord, children []ExecutionRecord, retries int, skippedPolls int) {
+	if events == nil {
+		return
+	}
+	succeeded, failed, pending := countChildren(children)
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.write(Event{
+		Type:                  EventSummary,
+		AutomationExecutionId: parent.AutomationExecutionId,
+		CommandId:             parent.CommandId,
+		DocumentName:          parent.DocumentName,
+		Status:                parent.Status,
+		FailureMessage:        parent.FailureMessage,
+		Succeeded:             &succeeded,
+		Failed:                &failed,
+		Pending:               &pending,
+		Retries:               &retries,
+		SkippedPolls:          &skippedPolls,
+	})
+}
+
+// countChildren counts every execution in the tree below the parent.
+func countChildren(children []ExecutionRecord) (succeeded int, failed int, pending int) {
+	for _, child := range children {
+		s, f, p := countChildren(child.Children)
+		succeeded, failed, pending = succeeded+s, failed+f, pending+p
+		isCompleted, isSuccess := child.isCompleted()
+		switch {
+		case !isCompleted:
+			pending++
+		case isSuccess:
+			succeeded++
+		default:
+			failed++
+		}
+	}
+	return succeeded, failed, pending
+}
+
+// isStepStarted is true once a step left Pending.
+func isStepStarted(status string) bool {
+	switch types.AutomationExecutionStatus(status) {
+	case types.AutomationExecutionStatusPending, "":
+		return false
+	}
+	return true
+}
+
+func isStepFinished(status string) bool {
+	isCompleted, _ := isCompletedAutomationStatus(types.AutomationExecutionStatus(status))
+	return isCompleted
+}
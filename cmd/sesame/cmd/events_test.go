@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readEvents(t *testing.T, out *bytes.Buffer) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("not ndjson [%s]: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventStreamTransitions(t *testing.T) {
+	var out bytes.Buffer
+	events := newEventStream(&out)
+	events.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+
+	child := ExecutionRecord{AutomationExecutionId: "child-1", ParentExecutionId: "parent-1", Target: "mi-1", Status: "InProgress",
+		Steps: []StepRecord{{StepName: "run", StepExecutionId: "step-1", Status: "Pending"}}}
+	events.parent(ExecutionRecord{AutomationExecutionId: "parent-1", Status: "InProgress"})
+	events.child(child)
+	// an unchanged poll writes nothing
+	events.parent(ExecutionRecord{AutomationExecutionId: "parent-1", Status: "InProgress"})
+	events.child(child)
+
+	child.Steps[0].Status = "InProgress"
+	events.child(child)
+	child.Status = "Success"
+	child.Steps[0].Status = "Success"
+	child.Steps[0].Commands = []CommandRecord{{CommandId: "cmd-1", InstanceId: "mi-1", PluginName: "aws:runShellScript", Status: "Success", Output: "ok"}}
+	events.child(child)
+	events.parent(ExecutionRecord{AutomationExecutionId: "parent-1", Status: "Success"})
+	events.summary(ExecutionRecord{AutomationExecutionId: "parent-1", Status: "Success"}, []ExecutionRecord{child}, 2, 0)
+
+	var types []string
+	for _, event := range readEvents(t, &out) {
+		types = append(types, event.Type+":"+event.Status)
+		if event.Time.IsZero() {
+			t.Errorf("[%s]: missing time", event.Type)
+		}
+	}
+	expected := []string{
+		"parent.status:InProgress",
+		"child.status:InProgress",
+		"step.started:InProgress",
+		"child.status:Success",
+		"step.finished:Success",
+		"command.output:Success",
+		"parent.status:Success",
+		"summary:Success",
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v, got %v", expected, types)
+	}
+}
+
+func TestEventStreamCommandOutput(t *testing.T) {
+	var out bytes.Buffer
+	events := newEventStream(&out)
+	child := ExecutionRecord{AutomationExecutionId: "child-1", Target: "mi-1", Status: "InProgress"}
+	command := CommandRecord{CommandId: "cmd-1", InstanceId: "mi-1", PluginName: "aws:runShellScript", Status: "InProgress", Output: "step 1"}
+	events.command(child, StepRecord{}, command)
+	// the same output again writes nothing
+	events.command(child, StepRecord{}, command)
+	command.Output = "step 1\nstep 2"
+	events.command(child, StepRecord{}, command)
+	command.Status = "Success"
+	events.command(child, StepRecord{}, command)
+
+	var written []string
+	for _, event := range readEvents(t, &out) {
+		written = append(written, event.Status+"|"+event.PreviousStatus+"|"+event.Output)
+	}
+	expected := []string{"InProgress||step 1", "InProgress||step 2", "Success|InProgress|"}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("expected %q, got %q", expected, written)
+	}
+}
+
+func TestEventSchema(t *testing.T) {
+	var out bytes.Buffer
+	events := newEventStream(&out)
+	events.parent(ExecutionRecord{CommandId: "cmd-1", Status: "InProgress"})
+	var fields map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Time", "Type", "AutomationExecutionId", "CommandId", "Status"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("expected %s in %s", field, out.String())
+		}
+	}
+}
+
+func TestCountChildren(t *testing.T) {
+	nested := []ExecutionRecord{{Status: "Success"}, {Status: "Failed", Children: []ExecutionRecord{{Status: "Failed"}}}}
+	children := []ExecutionRecord{{Status: "Success"}, {Status: "Failed"}, {Status: "TimedOut"}, {Status: "InProgress", Children: nested}}
+	succeeded, failed, pending := countChildren(children)
+	if succeeded != 2 || failed != 4 || pending != 1 {
+		t.Errorf("expected 2/4/1, got %d/%d/%d", succeeded, failed, pending)
+	}
+}
+
+func TestNilEventStream(t *testing.T) {
+	var events *eventStream
+	events.parent(ExecutionRecord{Status: "Success"})
+	events.child(ExecutionRecord{Status: "Success"})
+	events.summary(ExecutionRecord{}, nil, 0, 0)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+)
+
+// Exit codes, the same for every command so a script can tell how a run ended:
+//
+//	0 ExitSuccess   everything succeeded
+//	1 ExitInternal  sesame failed, a bad flag, an unexpected AWS error or a bug
+//	2 ExitFailed    the automation or command failed
+//	3 ExitPartial   some targets, or scopes, failed and some succeeded
+//	4 ExitTimeout   tracking ended with the execution still running
+//	5 ExitNotFound  no such execution, command, instance or no target matched
+//	6 ExitAuth      AWS credentials are missing, expired or not allowed to make the call
+const ExitSuccess = 0
+const ExitInternal = 1
+const ExitFailed = 2
+const ExitPartial = 3
+const ExitTimeout = 4
+const ExitNotFound = 5
+const ExitAuth = 6
+
+// exitCodeOf sorts an error ending the run, a SesameError may say which code it is.
+func exitCodeOf(err error) int {
+	var sesameErr *SesameError
+	if errors.As(err, &sesameErr) && sesameErr.code != 0 {
+		return sesameErr.code
+	}
+	switch classifyError(err) {
+	case ErrorClassAuth:
+		return ExitAuth
+	case ErrorClassNotFound:
+		return ExitNotFound
+	}
+	return ExitInternal
+}
+
+// automationExitCode sorts how the tracked execution and its children ended. A failed child decides, otherwise the
+// parent has to have completed as well, it may still fail a step of its own after its children succeeded.
+func automationExitCode(parent ExecutionRecord, children []ExecutionRecord) int {
+	succeeded, failed, pending := countChildren(children)
+	isCompleted, isSuccess := parent.isCompleted()
+	switch {
+	case failed > 0 && succeeded > 0:
+		return ExitPartial
+	case failed > 0:
+		return ExitFailed
+	case isCompleted && !isSuccess:
+		return ExitFailed
+	case pending > 0 || !isCompleted:
+		return ExitTimeout
+	}
+	return ExitSuccess
+}
+
+// partialExitCode is ExitPartial when some of the results are missing, ExitNotFound when they all are.
+func partialExitCode(found int) int {
+	if found == 0 {
+		return ExitNotFound
+	}
+	return ExitPartial
+}
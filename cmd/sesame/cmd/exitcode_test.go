@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+func TestExitCodeOf(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"not found", &SesameError{msg: "No results for execution id.", code: ExitNotFound}, ExitNotFound},
+		{"bad flag", &SesameError{msg: "unknown output [xml]"}, ExitInternal},
+		{"access denied", fmt.Errorf("operation error: %w", &smithy.GenericAPIError{Code: "AccessDeniedException"}), ExitAuth},
+		{"no credentials", &v4.SigningError{Err: errors.New("failed to retrieve credentials")}, ExitAuth},
+		{"no execution", &smithy.GenericAPIError{Code: "AutomationExecutionNotFoundException"}, ExitNotFound},
+		{"anything else", errors.New("boom"), ExitInternal},
+	}
+	for _, c := range cases {
+		if code := exitCodeOf(c.err); code != c.expected {
+			t.Errorf("[%s]: expected %d, got %d", c.name, c.expected, code)
+		}
+	}
+}
+
+func TestAutomationExitCode(t *testing.T) {
+	child := func(status string) ExecutionRecord {
+		return ExecutionRecord{AutomationExecutionId: "exec-" + status, Status: status}
+	}
+	parent := func(status string) ExecutionRecord {
+		return ExecutionRecord{AutomationExecutionId: "exec-1", Status: status}
+	}
+	cases := []struct {
+		name     string
+		parent   ExecutionRecord
+		children []ExecutionRecord
+		expected int
+	}{
+		{"succeeded", parent("Success"), []ExecutionRecord{child("Success"), child("Success")}, ExitSuccess},
+		{"parent still running after its children", parent("InProgress"), []ExecutionRecord{child("Success")}, ExitTimeout},
+		{"failed", parent("Failed"), []ExecutionRecord{child("Failed")}, ExitFailed},
+		{"partial", parent("Failed"), []ExecutionRecord{child("Success"), child("Failed")}, ExitPartial},
+		{"nested partial", parent("Failed"), []ExecutionRecord{{AutomationExecutionId: "exec-2", Status: "Failed", Children: []ExecutionRecord{child("Success")}}}, ExitPartial},
+		{"parent failed on its own", parent("Failed"), []ExecutionRecord{child("Success")}, ExitFailed},
+		{"still running", parent("InProgress"), []ExecutionRecord{child("Success"), child("InProgress")}, ExitTimeout},
+		{"no children yet", parent("InProgress"), nil, ExitTimeout},
+		{"command failed without invocations", ExecutionRecord{CommandId: "cmd-1", Status: "NoInstancesInTag"}, nil, ExitFailed},
+		{"command succeeded", ExecutionRecord{CommandId: "cmd-1", Status: "Success"}, []ExecutionRecord{{CommandId: "cmd-1", Target: "i-1", Status: "Success"}}, ExitSuccess},
+	}
+	for _, c := range cases {
+		if code := automationExitCode(c.parent, c.children); code != c.expected {
+			t.Errorf("[%s]: expected %d, got %d", c.name, c.expected, code)
+		}
+	}
+}
+
+func TestPartialExitCode(t *testing.T) {
+	if partialExitCode(0) != ExitNotFound || partialExitCode(2) != ExitPartial {
+		t.Errorf("expected nothing found to be not found and some found partial")
+	}
+}
+
+func TestTrackomateExitCode(t *testing.T) {
+	running := ExecutionRecord{AutomationExecutionId: "exec-1", Status: "InProgress"}
+	failed := ExecutionRecord{AutomationExecutionId: "exec-1", Status: "Failed"}
+	cases := []struct {
+		name       string
+		parent     ExecutionRecord
+		onTimeout  string
+		isTimedOut bool
+		expected   int
+	}{
+		{"failed", failed, OnTimeoutFail, false, ExitFailed},
+		{"gave up still running", running, OnTimeoutFail, false, ExitTimeout},
+		{"timed out", running, OnTimeoutFail, true, ExitTimeout},
+		{"timed out and stopped", ExecutionRecord{AutomationExecutionId: "exec-1", Status: "Cancelled"}, OnTimeoutStop, true, ExitTimeout},
+		{"timed out and left running", running, OnTimeoutLeave, true, ExitSuccess},
+	}
+	for _, c := range cases {
+		trackomate := &Trackomate{parent: c.parent, onTimeout: c.onTimeout, isTimedOut: c.isTimedOut}
+		if code := trackomate.exitCode(); code != c.expected {
+			t.Errorf("[%s]: expected %d, got %d", c.name, c.expected, code)
+		}
+	}
+}
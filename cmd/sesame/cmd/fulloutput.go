@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Heraclitus/sesame/pkg/aws/fulloutput"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+var isFullOutput bool
+var saveOutputDir string
+var s3Endpoint string
+var logsEndpoint string
+
+// outputFetcher reads from S3 and CloudWatch Logs with the run's config, so its retries and rate limit too.
+func (trackomate *Trackomate) outputFetcher() *fulloutput.Fetcher {
+	return fulloutput.NewFetcher(trackomate.awsConfig, s3Endpoint, logsEndpoint)
+}
+
+// newCommandRecord is the output of one plugin on one instance. Once the plugin completed, output SSM truncated is
+// replaced by the full stdout and stderr from S3 or CloudWatch Logs, and saved under --save-output.
+func (trackomate *Trackomate) newCommandRecord(commandId string, invocation types.CommandInvocation, plugin types.CommandPlugin) CommandRecord {
+	record := CommandRecord{
+		CommandId:  commandId,
+		InstanceId: aws.ToString(invocation.InstanceId),
+		PluginName: aws.ToString(plugin.Name),
+		Status:     string(plugin.Status),
+		Output:     aws.ToString(plugin.Output),
+	}
+	if isCompleted, _ := isCompletedCommandStatus(record.Status); !isCompleted {
+		return record
+	}
+	if cached, ok := trackomate.cache.cachedOutput(record.key()); ok {
+		return cached
+	}
+	if isFullOutput && fulloutput.IsTruncated(record.Output) {
+		stdout, stderr, source, err := trackomate.fetchFullOutput(context.Background(), invocation, plugin)
+		if err != nil {
+			_, _ = fmt.Fprintf(reportOut(), "  REPORT: keeping the truncated output of %s: %v\n", record.key(), err)
+			if isTransientError(err) {
+				// try again on the next poll
+				return record
+			}
+		} else {
+			record.Output, record.Stderr, record.OutputSource = stdout, stderr, source
+		}
+	}
+	if saveOutputDir != "" {
+		if err := saveCommandOutput(saveOutputDir, record); err != nil {
+			_, _ = fmt.Fprintf(reportOut(), "  REPORT: not saved %s: %v\n", record.key(), err)
+		}
+	}
+	trackomate.cache.putOutput(record.key(), record)
+	return record
+}
+
+// fetchFullOutput reads a plugin's stdout and stderr from the S3 bucket, or else the CloudWatch log group,
+// the command was sent with.
+// - S3 keys are <OutputS3KeyPrefix>/<CommandId>/<InstanceId>/<plugin dir>/.../stdout
+// - log streams are <CommandId>/<InstanceId>/<plugin name with : as ->/stdout in /aws/ssm/<DocumentName> by default
+func (trackomate *Trackomate) fetchFullOutput(ctx context.Context, invocation types.CommandInvocation, plugin types.CommandPlugin) (string, string, string, error) {
+	fetcher := trackomate.outputFetcher()
+	commandId := aws.ToString(invocation.CommandId)
+	instanceId := aws.ToString(invocation.InstanceId)
+	name := aws.ToString(plugin.Name)
+	if bucket := aws.ToString(plugin.OutputS3BucketName); bucket != "" {
+		region := aws.ToString(plugin.OutputS3Region)
+		prefix := strings.TrimPrefix(strings.Join([]string{strings.Trim(aws.ToString(plugin.OutputS3KeyPrefix), "/"), commandId, instanceId, ""}, "/"), "/")
+		keys, err := fetcher.S3Keys(ctx, bucket, prefix, region)
+		if err != nil {
+			return "", "", "", err
+		}
+		stdoutKey := pluginStdoutKey(keys, name)
+		if stdoutKey == "" {
+			return "", "", "", fmt.Errorf("%w: no stdout under s3://%s/%s", fulloutput.ErrNotFound, bucket, prefix)
+		}
+		stdout, err := fetcher.S3Object(ctx, bucket, stdoutKey, region)
+		if err != nil {
+			return "", "", "", err
+		}
+		stderr, err := fetcher.S3Object(ctx, bucket, strings.TrimSuffix(stdoutKey, "stdout")+"stderr", region)
+		if err != nil && !errors.Is(err, fulloutput.ErrNotFound) {
+			return "", "", "", err
+		}
+		return stdout, stderr, fmt.Sprintf("s3://%s/%s", bucket, stdoutKey), nil
+	}
+	if config := invocation.CloudWatchOutputConfig; config != nil && config.CloudWatchOutputEnabled {
+		group := aws.ToString(config.CloudWatchLogGroupName)
+		if group == "" {
+			group = "/aws/ssm/" + aws.ToString(invocation.DocumentName)
+		}
+		stream := strings.Join([]string{commandId, instanceId, strings.ReplaceAll(name, ":", "-")}, "/")
+		stdout, err := fetcher.LogEvents(ctx, group, stream+"/stdout")
+		if err != nil {
+			return "", "", "", err
+		}
+		stderr, err := fetcher.LogEvents(ctx, group, stream+"/stderr")
+		if err != nil && !errors.Is(err, fulloutput.ErrNotFound) {
+			return "", "", "", err
+		}
+		return stdout, stderr, fmt.Sprintf("logs:%s:%s/stdout", group, stream), nil
+	}
+	return "", "", "", &SesameError{msg: "the command was sent without an S3 bucket or CloudWatch log group for its output"}
+}
+
+// pluginStdoutKey picks the plugin's stdout from the keys of an invocation, its directory is the plugin name without the colon.
+func pluginStdoutKey(keys []string, pluginName string) string {
+	var stdoutKeys []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/stdout") {
+			stdoutKeys = append(stdoutKeys, key)
+		}
+	}
+	dir := strings.ReplaceAll(pluginName, ":", "")
+	for _, key := range stdoutKeys {
+		if strings.Contains(key, "/"+dir+"/") || strings.Contains(key, "."+dir+"/") {
+			return key
+		}
+	}
+	if len(stdoutKeys) == 1 {
+		return stdoutKeys[0]
+	}
+	return ""
+}
+
+// saveCommandOutput writes the output to <dir>/<instance id>/<command id>.<plugin>.stdout, and .stderr.
+func saveCommandOutput(dir string, record CommandRecord) error {
+	hostDir := filepath.Join(dir, record.InstanceId)
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return err
+	}
+	base := filepath.Join(hostDir, fmt.Sprintf("%s.%s", record.CommandId, strings.ReplaceAll(record.PluginName, ":", "-")))
+	if err := os.WriteFile(base+".stdout", []byte(record.Output), 0644); err != nil {
+		return err
+	}
+	if record.Stderr == "" {
+		return nil
+	}
+	return os.WriteFile(base+".stderr", []byte(record.Stderr), 0644)
+}
+
+// printCommandOutput reports a plugin's output under what, e.g. " CHILD" or " TARGET".
+func printCommandOutput(what string, command CommandRecord) {
+	from := ""
+	if command.OutputSource != "" {
+		from = fmt.Sprintf(" (%s)", command.OutputSource)
+	}
+	if command.Output == "" {
+		_, _ = fmt.Fprintf(progressOut(), "%s: [%s:%s]: output: -empty-\n", what, command.PluginName, command.CommandId)
+	} else {
+		_, _ = fmt.Fprintf(progressOut(), "%s: [%s:%s]: output%s: \n\t%s\n", what, command.PluginName, command.CommandId, from, strings.Replace(command.Output, "\n", "\n\t", -1))
+	}
+	if command.Stderr != "" {
+		_, _ = fmt.Fprintf(progressOut(), "%s: [%s:%s]: stderr: \n\t%s\n", what, command.PluginName, command.CommandId, strings.Replace(command.Stderr, "\n", "\n\t", -1))
+	}
+}
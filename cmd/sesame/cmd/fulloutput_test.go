@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Heraclitus/sesame/pkg/aws/fulloutput"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestPluginStdoutKey(t *testing.T) {
+	keys := []string{
+		"ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stderr",
+		"ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stdout",
+		"ssm/cmd-1/i-1/awsrunPowerShellScript/0.awsrunPowerShellScript/stdout",
+	}
+	cases := []struct {
+		keys       []string
+		pluginName string
+		expected   string
+	}{
+		{keys, "aws:runShellScript", keys[1]},
+		{keys, "aws:runPowerShellScript", keys[2]},
+		{keys, "aws:downloadContent", ""},
+		{keys[:2], "runScript", keys[1]},
+	}
+	for _, c := range cases {
+		if key := pluginStdoutKey(c.keys, c.pluginName); key != c.expected {
+			t.Errorf("[%s]: expected %q, got %q", c.pluginName, c.expected, key)
+		}
+	}
+}
+
+func TestSaveCommandOutput(t *testing.T) {
+	dir := t.TempDir()
+	record := CommandRecord{CommandId: "cmd-1", InstanceId: "i-1", PluginName: "aws:runShellScript", Output: "out", Stderr: "err"}
+	if err := saveCommandOutput(dir, record); err != nil {
+		t.Fatal(err)
+	}
+	for suffix, expected := range map[string]string{".stdout": "out", ".stderr": "err"} {
+		saved, err := os.ReadFile(filepath.Join(dir, "i-1", "cmd-1.aws-runShellScript"+suffix))
+		if err != nil || string(saved) != expected {
+			t.Errorf("[%s]: expected %q, got %q %v", suffix, expected, saved, err)
+		}
+	}
+}
+
+func TestNewCommandRecordFullOutput(t *testing.T) {
+	full := strings.Repeat("x", fulloutput.MaxOutput) + "\nthe failure past the cut"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Query().Get("list-type") == "2":
+			_, _ = fmt.Fprint(w, "<ListBucketResult><Contents><Key>ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stdout</Key></Contents></ListBucketResult>")
+		case strings.HasSuffix(r.URL.Path, "/stdout"):
+			_, _ = fmt.Fprint(w, full)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+		}
+	}))
+	defer server.Close()
+	defer func(endpoint string, isFull bool) { s3Endpoint, isFullOutput = endpoint, isFull }(s3Endpoint, isFullOutput)
+	s3Endpoint, isFullOutput = server.URL, true
+
+	trackomate := newTrackomate("", -1)
+	trackomate.awsConfig.Region = "us-east-1"
+	trackomate.awsConfig.Credentials = aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+	})
+	invocation := types.CommandInvocation{CommandId: aws.String("cmd-1"), InstanceId: aws.String("i-1")}
+	plugin := types.CommandPlugin{
+		Name:               aws.String("aws:runShellScript"),
+		Status:             types.CommandPluginStatusFailed,
+		Output:             aws.String(full[:fulloutput.MaxOutput-len(fulloutput.TruncatedMarker)] + fulloutput.TruncatedMarker),
+		OutputS3BucketName: aws.String("logs"),
+		OutputS3KeyPrefix:  aws.String("ssm/"),
+	}
+	for i := 0; i < 2; i++ {
+		record := trackomate.newCommandRecord("cmd-1", invocation, plugin)
+		if record.Output != full || record.OutputSource != "s3://logs/ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stdout" {
+			t.Errorf("expected the full output from S3, got %.40q from %s", record.Output, record.OutputSource)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected the list, stdout and stderr requests once, got %d", requests)
+	}
+
+	plugin.Output = aws.String("short and sweet")
+	invocation.InstanceId = aws.String("i-2")
+	if record := trackomate.newCommandRecord("cmd-1", invocation, plugin); record.Output != "short and sweet" || requests != 3 {
+		t.Errorf("expected output that wasn't truncated to be kept, got %q after %d requests", record.Output, requests)
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/Heraclitus/sesame/cmd/sesame/automation"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/aws/smithy-go/ptr"
 	"github.com/jroimartin/gocui"
-	"github.com/madflojo/tasks"
 	"github.com/spf13/cobra"
 	"io"
 	"log"
@@ -17,7 +17,6 @@ import (
 	"os/exec"
 	"sort"
 	"strings"
-	"text/template"
 	"time"
 )
 
@@ -35,8 +34,7 @@ var (
 )
 
 var filterTag string
-var filterTagName string
-var filterTagValue string
+var filterTarget *ssmsearch.Expression
 var bestNameTag string
 var automationDocumentName string
 var helperBashFilePathAndName string
@@ -45,6 +43,8 @@ var gal = Gallery{
 	SSMCommand{},
 	[]UsefullyNamed{},
 	"",
+	nil,
+	nil,
 	"",
 	"",
 	nil,
@@ -55,18 +55,28 @@ var automationLibSearchPath = "./"
 var automationLibs []automation.AutomationLib
 var ssmAutomationParams = SSMAutomationParameters{"", "", "", "", "", "", "", make(map[string]string)}
 
+// UsefullyNamed is a host in the gallery, it is also what gallerate --output and --format print.
 type UsefullyNamed struct {
 	InstanceId string
-	Name       string
-	Status     string
-	TagList    []types.Tag
+	// Name is the --bestNameTag value, or the EC2 name for EC2 instances.
+	Name string
+	// Status is the SSM ping status, e.g. Online or ConnectionLost.
+	Status  string
+	Tags    map[string]string
+	TagList []types.Tag `json:"-"`
+	// Everything is the InstanceInformation SSM has for the host.
 	Everything types.InstanceInformation
+	Account    string
+	Region     string
+	Scope      Scope `json:"-"`
 }
 
 type Gallery struct {
 	SSMCommand
 	Instances        []UsefullyNamed
 	TimeOfRetrieve   string
+	scopeErrors      []string
+	scopesErr        error
 	openSsmSessionTo string
 	trackomateOn     string
 	instance         *UsefullyNamed
@@ -84,19 +94,24 @@ type SSMAutomationParameters struct {
 	params            map[string]string
 }
 
+// templateContext is what automation parameter templates are executed with, e.g. {{.Tags.Env}}.
 type templateContext struct {
 	Tags map[string]string
+	// InstanceId and Name are the target's, sesame run sets them.
+	InstanceId string
+	Name       string
 }
 
 func init() {
 
-	gallerateCmd.Flags().StringVarP(&filterTag, "filterTag", "t", "", "Provide a Tag key:value to filter the gallery.")
+	gallerateCmd.Flags().StringVarP(&filterTag, "filterTag", "t", "", "Provide a target expression, e.g. \"CostCenter=FunTeam and ping=Online\" (or the older CostCenter:FunTeam), or an alias, to filter the gallery.")
 	gallerateCmd.Flags().StringVarP(&bestNameTag, "bestNameTag", "n", "", "Provide a Tag key name that has the best value for a UI friendly name.")
 	gallerateCmd.Flags().StringVarP(&automationDocumentName, "autodocname", "a", "", "Provide an ssm automation document name for use in commanding. OPTIONAL")
 	gallerateCmd.Flags().StringVarP(&ssmAutomationParams.ghSshKeyParamName, "autosshparamname", "g", "", "Provide an ssm parameter name containing a GitHub SSH Key w/repo permissions. OPTIONAL")
 	gallerateCmd.Flags().StringVarP(&automationLibSearchPath, "libsearchpath", "l", "./", "Provide a path to search for library automations. OPTIONAL")
 	gallerateCmd.Flags().StringVarP(&helperBashFilePathAndName, "helperBash", "b", ssmInvokeHelperShell, "Provide a local full-or-relative path invocation helper script. OPTIONAL")
 	gallerateCmd.Flags().StringVarP(&automationParameterValues, "autoParams", "p", defaultGitBasedAutomation, "Provide parameters to pass to the helperBash script. DEFAULT IS EXAMPLE ONLY!")
+	addScopeFlags(gallerateCmd)
 	err := gallerateCmd.MarkFlagRequired("filterTag")
 	if err != nil {
 		exitOnError(err)
@@ -105,6 +120,14 @@ func init() {
 	if err != nil {
 		exitOnError(err)
 	}
+	err = gallerateCmd.RegisterFlagCompletionFunc("autodocname", libraryCompletions)
+	if err != nil {
+		exitOnError(err)
+	}
+	err = gallerateCmd.RegisterFlagCompletionFunc("libsearchpath", directoryCompletions)
+	if err != nil {
+		exitOnError(err)
+	}
 	rootCmd.AddCommand(gallerateCmd)
 	gal.conf()
 }
@@ -112,15 +135,34 @@ func init() {
 var gallerateCmd = &cobra.Command{
 	Use:   "gallerate",
 	Short: "Walk through SSM like it was a gallery",
-	Long:  ``,
+	Long: `Browse the hosts matching --filterTag, open sessions to them and run automations against them.
+
+With --output or --format the gallery is printed instead of opening the UI, e.g.
+  sesame gallerate -t "Env=prod" -n Nickname --format '{{.InstanceId}} {{.Tags.Nickname}}'`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		if strings.Contains(filterTag, ":") || strings.HasSuffix(filterTag, ":") || strings.HasPrefix(filterTag, ":") {
-			var parts = strings.Split(filterTag, ":")
-			filterTagName = parts[0]
-			filterTagValue = parts[1]
-		} else {
-			exitOnError(&SesameError{msg: "filterTag needs to be tagName:tagValue, e.g. CostCenter:FunTeam\nYou provided [" + filterTag + "]"})
+		if _, isAlias := loadAliases().Lookup(filterTag); !isAlias {
+			var err error
+			filterTarget, err = parseTarget(filterTag)
+			exitOnError(err)
+		}
+
+		if isOutputRequested(cmd) {
+			gal.collect()
+			for _, scopeErr := range gal.scopeErrors {
+				_, _ = fmt.Fprintln(os.Stderr, scopeErr)
+			}
+			if gal.scopesErr != nil {
+				os.Exit(exitCodeOf(gal.scopesErr))
+			}
+			if len(gal.Instances) == 0 {
+				exitOnError(&SesameError{msg: "No results for tag filter.", code: ExitNotFound})
+			}
+			exitOnError(gal.write())
+			if len(gal.scopeErrors) > 0 {
+				os.Exit(ExitPartial)
+			}
+			return
 		}
 
 		g, err := gocui.NewGui(gocui.OutputNormal)
@@ -203,6 +245,7 @@ var gallerateCmd = &cobra.Command{
 				cmd.Stdout = os.Stdout
 				cmd.Stderr = os.Stderr
 				cmd.Stdin = os.Stdin
+				cmd.Env = gal.instance.Scope.environ()
 				if err := cmd.Run(); err != nil {
 					log.Fatal(err)
 				}
@@ -211,6 +254,7 @@ var gallerateCmd = &cobra.Command{
 				cmd.Stdout = os.Stdout
 				cmd.Stderr = os.Stderr
 				cmd.Stdin = os.Stdin
+				cmd.Env = gal.instance.Scope.environ()
 				if err := cmd.Run(); err != nil {
 					log.Fatal(err)
 				}
@@ -235,6 +279,7 @@ var gallerateCmd = &cobra.Command{
 					fmt.Printf("%d, arg: %s\n", i, arg)
 				}
 				cmd = exec.Command(helperBashFilePathAndName, allArgs...)
+				cmd.Env = gal.instance.Scope.environ()
 				var outb, errb bytes.Buffer
 				cmd.Stdout = &outb
 				cmd.Stderr = &errb
@@ -257,9 +302,8 @@ var gallerateCmd = &cobra.Command{
 							panic("Missing AutomationExecutionId, can't trackomate!")
 						} else {
 							id := searchForId[1]
-							reportChan := make(chan string, 10)
-							t := Trackomate{SSMCommand{}, maxRecords, &reportChan, tasks.New(), "", "", id, -1, 0}
-							t.conf()
+							t := newTrackomate(id, -1)
+							t.confScope(gal.instance.Scope)
 							t.thingDo()
 						}
 					}
@@ -269,23 +313,15 @@ var gallerateCmd = &cobra.Command{
 				maxConcur := "1"
 				params := make(map[string][]string)
 
+				mapOfTagKeyValues := make(map[string]string)
+				for _, tag := range gal.instance.TagList {
+					mapOfTagKeyValues[*tag.Key] = *tag.Value
+				}
+				contexts := []templateContext{{Tags: mapOfTagKeyValues, InstanceId: gal.instance.InstanceId, Name: gal.instance.Name}}
 				for k, v := range ssmAutomationParams.params {
-					mapOfTagKeyValues := make(map[string]string)
-					if strings.Contains(v, "{{") {
-						for _, tag := range gal.instance.TagList {
-							mapOfTagKeyValues[*tag.Key] = *tag.Value
-						}
-						templateContext := templateContext{Tags: mapOfTagKeyValues}
-						tmpl, err := template.New(k).Parse(v)
-						exitOnError(err)
-						nVal := strings.Builder{}
-
-						err = tmpl.Execute(&nVal, templateContext)
-						exitOnError(err)
-						params[k] = []string{nVal.String()}
-					} else {
-						params[k] = []string{v}
-					}
+					nVal, err := expandTemplate(k, v, contexts)
+					exitOnError(err)
+					params[k] = []string{nVal}
 				}
 				var targets = make([]types.Target, 1)
 				targets[0] = types.Target{
@@ -301,11 +337,12 @@ var gallerateCmd = &cobra.Command{
 					Targets:             targets,
 					TargetParameterName: ptr.String("InstanceIds"),
 				}
-				execOutput, execError := gal.svc.StartAutomationExecution(context.Background(), execInput)
+				starter := SSMCommand{}
+				starter.confScope(gal.instance.Scope)
+				execOutput, execError := starter.svc.StartAutomationExecution(context.Background(), execInput)
 				exitOnError(execError)
-				reportChan := make(chan string, 10)
-				t := Trackomate{SSMCommand{}, maxRecords, &reportChan, tasks.New(), "", "", *execOutput.AutomationExecutionId, -1, 0}
-				t.conf()
+				t := newTrackomate(*execOutput.AutomationExecutionId, -1)
+				t.confScope(gal.instance.Scope)
 				t.thingDo()
 			}
 		}
@@ -376,70 +413,38 @@ func layout(g *gocui.Gui) error {
 	return nil
 }
 
-func (gallery *Gallery) thingDoWithTarget(g *gocui.Gui, inventoryView *gocui.View, footer *gocui.View) error {
-	// Create our filter slice
-	k := fmt.Sprintf("tag:%s", filterTagName)
-	filters := []types.InstanceInformationStringFilter{
-		{
-			Key:    &k,
-			Values: []string{filterTagValue},
-		},
-	}
-
-	const ApiMin = 50
-	maxRes := int32(ApiMin)
-	input := &ssm.DescribeInstanceInformationInput{
-		Filters:    filters,
-		MaxResults: &maxRes,
-	}
-
-	pageNum := 0
-	gallery.Instances = []UsefullyNamed{}
-	pager := ssm.NewDescribeInstanceInformationPaginator(gallery.svc, input, func(o *ssm.DescribeInstanceInformationPaginatorOptions) {})
-
-	for pager.HasMorePages() {
-		page, err := pager.NextPage(context.Background())
-		if err != nil {
-			panic(err)
+// collect gathers the gallery from every scope, sorted by name with the unnamed last.
+func (gallery *Gallery) collect() {
+	scoped := forEachScope(selectedScopes(), func(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error) {
+		if filterTarget == nil {
+			aliased, _, err := ssmCommand.resolveAlias(ctx, filterTag)
+			return aliased, err
 		}
-		pageNum++
-		gallery.TimeOfRetrieve = time.Now().String()
-		for _, value := range page.InstanceInformationList {
-
-			aNamedThing := UsefullyNamed{InstanceId: *value.InstanceId, Status: string(value.PingStatus), Everything: value}
-			if value.ResourceType == types.ResourceTypeEc2Instance {
-				if value.Name == nil {
-					aNamedThing.Name = *value.InstanceId
+		return ssmCommand.searcher().SearchByExpression(ctx, filterTarget)
+	})
+	gallery.TimeOfRetrieve = time.Now().String()
+	gallery.Instances = []UsefullyNamed{}
+	gallery.scopeErrors = nil
+	gallery.scopesErr = allScopesFailed(scoped)
+	for _, s := range scoped {
+		if s.Err != nil {
+			gallery.scopeErrors = append(gallery.scopeErrors, fmt.Sprintf("[%s]: %v", s.Scope, s.Err))
+		}
+		for _, instance := range s.Instances {
+			aNamedThing := UsefullyNamed{InstanceId: instance.InstanceId, Status: instance.PingStatus, Tags: instance.Tags, TagList: toTagList(instance.Tags), Everything: instance.Information, Account: s.Account, Region: s.Region, Scope: s.Scope}
+			if instance.ResourceType == string(types.ResourceTypeEc2Instance) {
+				if instance.Name == "" {
+					aNamedThing.Name = instance.InstanceId
 				} else {
-					aNamedThing.Name = *value.Name
-				}
-				aNamedThing.TagList = make([]types.Tag, 0)
-				gallery.Instances = append(gallery.Instances, aNamedThing)
-			} else if value.ResourceType == types.ResourceTypeManagedInstance {
-				tagInput := &ssm.ListTagsForResourceInput{
-					ResourceId:   value.InstanceId,
-					ResourceType: types.ResourceTypeForTagging(value.ResourceType),
+					aNamedThing.Name = instance.Name
 				}
-				listTagsForResourceOutput, listTagServiceError := gallery.svc.ListTagsForResource(context.Background(), tagInput)
-				if listTagServiceError != nil {
-					panic(listTagServiceError)
-				}
-
-				aNamedThing.TagList = listTagsForResourceOutput.TagList
-				for _, tagV := range listTagsForResourceOutput.TagList {
-					if bestNameTag == *tagV.Key {
-						aNamedThing.Name = *tagV.Value
-					}
-				}
-				gallery.Instances = append(gallery.Instances, aNamedThing)
+			} else {
+				aNamedThing.Name = instance.Tags[bestNameTag]
 			}
+			gallery.Instances = append(gallery.Instances, aNamedThing)
 		}
 	}
 
-	if pageNum == 0 {
-		return &SesameError{msg: "No results for tag filter."}
-	}
-
 	sort.Slice(gallery.Instances, func(i, j int) bool {
 		if gallery.Instances[i].Name == "" && gallery.Instances[j].Name != "" {
 			return false
@@ -450,6 +455,41 @@ func (gallery *Gallery) thingDoWithTarget(g *gocui.Gui, inventoryView *gocui.Vie
 		}
 		return gallery.Instances[i].Name < gallery.Instances[j].Name
 	})
+}
+
+// write prints the gallery without the TUI, for gallerate --output and --format.
+func (gallery *Gallery) write() error {
+	items := make([]interface{}, len(gallery.Instances))
+	for i := range gallery.Instances {
+		items[i] = gallery.Instances[i]
+	}
+	return writeOutput(os.Stdout, items, func(w io.Writer) error {
+		tw := newTableWriter(w)
+		_, err := fmt.Fprintln(tw, "NAME\tINSTANCE ID\tSTATUS\tACCOUNT\tREGION")
+		if err != nil {
+			return err
+		}
+		for _, named := range gallery.Instances {
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", named.Name, named.InstanceId, named.Status, named.Account, named.Region)
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	})
+}
+
+func (gallery *Gallery) thingDoWithTarget(g *gocui.Gui, inventoryView *gocui.View, footer *gocui.View) error {
+	gallery.collect()
+	if len(gallery.Instances) == 0 {
+		footer.Clear()
+		_ = gallery.printFooter(footer)
+		if gallery.scopesErr != nil {
+			return gallery.scopesErr
+		}
+		return &SesameError{msg: "No results for tag filter.", code: ExitNotFound}
+	}
+
 	inventoryView.Clear()
 	for _, value := range gallery.Instances {
 
@@ -482,8 +522,25 @@ func (gallery *Gallery) thingDoWithTarget(g *gocui.Gui, inventoryView *gocui.Vie
 	return nil
 }
 
+// toTagList keeps the gallery's tag listing in a stable, key sorted order.
+func toTagList(tags map[string]string) []types.Tag {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tagList := make([]types.Tag, 0, len(keys))
+	for _, k := range keys {
+		tagList = append(tagList, types.Tag{Key: ptr.String(k), Value: ptr.String(tags[k])})
+	}
+	return tagList
+}
+
 func (gallery *Gallery) printFooter(footer io.ReadWriter) error {
 	_, err := fmt.Fprintf(footer, "Total instance count: %d @(%s)\n", len(gallery.Instances), gallery.TimeOfRetrieve)
+	for _, scopeErr := range gallery.scopeErrors {
+		_, _ = fmt.Fprintln(footer, scopeErr)
+	}
 	if err == nil {
 		_, _ = fmt.Fprintln(footer, "Ctrl+r => Refresh gallery | Ctrl+s => SSM Session Open | Ctrl+m/Enter => Command Target")
 		_, _ = fmt.Fprintln(footer, "Ctrl+q => Quit            | Ctrl+c => Cancel/Quit      |")
@@ -569,6 +626,9 @@ func changeMainView(g *gocui.Gui, v *gocui.View) error {
 			sideSelectedNum = 0
 		}
 		_, _ = fmt.Fprintf(&b, "PING STATUS: %s (%s)\n", gal.Instances[sideSelectedNum].Status, gal.Instances[sideSelectedNum].Everything.LastPingDateTime)
+		if gal.Instances[sideSelectedNum].Account != "" {
+			_, _ = fmt.Fprintf(&b, "ACCOUNT: %s (%s)\n", gal.Instances[sideSelectedNum].Account, gal.Instances[sideSelectedNum].Region)
+		}
 		for _, t := range gal.Instances[sideSelectedNum].TagList {
 			_, _ = fmt.Fprintf(&b, "%s:\t%s\n", *t.Key, *t.Value)
 		}
@@ -606,6 +666,7 @@ func ssmStart(g *gocui.Gui, v *gocui.View) error {
 		sideSelectedNum = 0
 	}
 	gal.openSsmSessionTo = gal.Instances[sideSelectedNum].InstanceId
+	gal.instance = &gal.Instances[sideSelectedNum]
 
 	return gocui.ErrQuit
 }
@@ -720,7 +781,7 @@ func commandATarget(g *gocui.Gui, v *gocui.View) error {
 }
 
 func isMinimumArgsForDocAutomationEmpty() bool {
-	return ssmAutomationParams.docVersion == "" || ssmAutomationParams.docVersion == ""
+	return ssmAutomationParams.docName == "" || ssmAutomationParams.docVersion == ""
 }
 
 func isMinimumArgsForRepoAutomationEmpty() bool {
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// GitHub Actions hands a docker action its inputs as INPUT_<NAME> variables, and reads outputs and the job summary
+// back from the files GITHUB_OUTPUT and GITHUB_STEP_SUMMARY name.
+// - https://docs.github.com/en/actions/creating-actions/metadata-syntax-for-github-actions#inputs
+// - https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+const githubInputPrefix = "INPUT_"
+
+func isGithubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// githubInputNames are the variables an input of the flag's name may arrive in, GitHub upper cases the input name
+// and keeps its dashes, workflows that set env themselves tend to use underscores.
+func githubInputNames(flagName string) []string {
+	name := strings.ToUpper(flagName)
+	names := []string{githubInputPrefix + name}
+	if strings.Contains(name, "-") {
+		names = append(names, githubInputPrefix+strings.ReplaceAll(name, "-", "_"))
+	}
+	return names
+}
+
+// applyGithubInputs sets every flag of cmd that was not given, or given empty, from its INPUT_ variable.
+func applyGithubInputs(cmd *cobra.Command, getenv func(string) string) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || (flag.Changed && flag.Value.String() != "") {
+			return
+		}
+		for _, name := range githubInputNames(flag.Name) {
+			if value := getenv(name); value != "" {
+				if setErr := cmd.Flags().Set(flag.Name, value); setErr != nil {
+					err = &SesameError{msg: fmt.Sprintf("input %s: %v", name, setErr)}
+				}
+				return
+			}
+		}
+	})
+	return err
+}
+
+// GithubSummary is the summary output, what became of the tracked execution and its children.
+type GithubSummary struct {
+	AutomationExecutionId string   `json:",omitempty"`
+	CommandId             string   `json:",omitempty"`
+	DocumentName          string   `json:",omitempty"`
+	Status                string   `json:",omitempty"`
+	Succeeded             []string `json:",omitempty"`
+	Failed                []string `json:",omitempty"`
+	Pending               []string `json:",omitempty"`
+}
+
+func newGithubSummary(parent ExecutionRecord, children []ExecutionRecord) GithubSummary {
+	summary := GithubSummary{
+		AutomationExecutionId: parent.AutomationExecutionId,
+		CommandId:             parent.CommandId,
+		DocumentName:          parent.DocumentName,
+		Status:                parent.Status,
+	}
+	eachChild(children, func(child ExecutionRecord) {
+		target := child.Target
+		if target == "" {
+			target = child.key()
+		}
+		switch isCompleted, isSuccess := child.isCompleted(); {
+		case !isCompleted:
+			summary.Pending = append(summary.Pending, target)
+		case isSuccess:
+			summary.Succeeded = append(summary.Succeeded, target)
+		default:
+			summary.Failed = append(summary.Failed, target)
+		}
+	})
+	return summary
+}
+
+// eachChild visits the children, and theirs, depth first.
+func eachChild(children []ExecutionRecord, visit func(ExecutionRecord)) {
+	for _, child := range children {
+		visit(child)
+		eachChild(child.Children, visit)
+	}
+}
+
+// reportToGithub writes outputs, ::error:: annotations for failed children and a job summary table,
+// when running in GitHub Actions.
+func reportToGithub(parent ExecutionRecord, children []ExecutionRecord) error {
+	if !isGithubActions() {
+		return nil
+	}
+	summary := newGithubSummary(parent, children)
+	if err := writeGithubOutputs(os.Getenv("GITHUB_OUTPUT"), summary); err != nil {
+		return err
+	}
+	writeGithubAnnotations(progressOut(), children)
+	return appendToFile(os.Getenv("GITHUB_STEP_SUMMARY"), func(w io.Writer) error {
+		return writeGithubStepSummary(w, parent, children)
+	})
+}
+
+func writeGithubOutputs(path string, summary GithubSummary) error {
+	asJson, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	return appendToFile(path, func(w io.Writer) error {
+		outputs := []struct{ name, value string }{
+			{"execution-id", summary.AutomationExecutionId},
+			{"command-id", summary.CommandId},
+			{"status", summary.Status},
+			{"failed-targets", strings.Join(summary.Failed, ",")},
+			{"summary", string(asJson)},
+		}
+		for _, output := range outputs {
+			if _, err := fmt.Fprintf(w, "%s=%s\n", output.name, output.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeGithubAnnotations marks each failed child as an error on the workflow run.
+func writeGithubAnnotations(w io.Writer, children []ExecutionRecord) {
+	eachChild(children, func(child ExecutionRecord) {
+		if isCompleted, isSuccess := child.isCompleted(); !isCompleted || isSuccess {
+			return
+		}
+		message := fmt.Sprintf("%s[%s] %s", child.TargetName, child.Target, child.Status)
+		if child.FailureMessage != "" {
+			message += ": " + child.FailureMessage
+		}
+		_, _ = fmt.Fprintf(w, "::error title=%s::%s\n", escapeGithubProperty(child.DocumentName), escapeGithubData(message))
+	})
+}
+
+func writeGithubStepSummary(w io.Writer, parent ExecutionRecord, children []ExecutionRecord) error {
+	id := parent.AutomationExecutionId
+	if id == "" {
+		id = parent.CommandId
+	}
+	_, err := fmt.Fprintf(w, "### %s `%s`: %s\n\n| Target | Name | Document | Status | Duration |\n| --- | --- | --- | --- | --- |\n", parent.DocumentName, id, parent.Status)
+	if err != nil {
+		return err
+	}
+	eachChild(children, func(child ExecutionRecord) {
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", escapeMarkdownCell(child.Target), escapeMarkdownCell(child.TargetName), escapeMarkdownCell(child.DocumentName), child.Status, duration(child.ExecutionStartTime, child.ExecutionEndTime))
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+func duration(start *time.Time, end *time.Time) string {
+	if start == nil || end == nil || end.Before(*start) {
+		return ""
+	}
+	return end.Sub(*start).Round(time.Second).String()
+}
+
+// appendToFile appends what write writes to the file at path, an empty path, GitHub not naming the file, writes nothing.
+func appendToFile(path string, write func(io.Writer) error) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func escapeGithubData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func escapeGithubProperty(value string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeGithubData(value))
+}
+
+func escapeMarkdownCell(value string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(value)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func githubRecords() (ExecutionRecord, []ExecutionRecord) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	end := start.Add(95 * time.Second)
+	parent := ExecutionRecord{AutomationExecutionId: "parent-1", DocumentName: "Patch", Status: "Failed"}
+	children := []ExecutionRecord{
+		{AutomationExecutionId: "child-1", DocumentName: "PatchOne", Status: "Success", Target: "i-1", TargetName: "web", ExecutionStartTime: &start, ExecutionEndTime: &end},
+		{AutomationExecutionId: "child-2", DocumentName: "PatchOne", Status: "Failed", Target: "i-2", TargetName: "db|1", FailureMessage: "step install failed:\nexit 1",
+			Children: []ExecutionRecord{{AutomationExecutionId: "grandchild-1", DocumentName: "Reboot", Status: "InProgress", Target: "i-2"}}},
+	}
+	return parent, children
+}
+
+func TestApplyGithubInputs(t *testing.T) {
+	var id, commandId, events string
+	var tie bool
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().StringVarP(&id, "id", "i", "", "")
+	cmd.Flags().StringVar(&commandId, "command-id", "", "")
+	cmd.Flags().StringVar(&events, "events", "", "")
+	cmd.Flags().BoolVarP(&tie, "tieAutomationStatusToExitCode", "e", false, "")
+	// the action's default flag1 passes -i with an empty flag1Arg
+	exitOnError(cmd.ParseFlags([]string{"-i", "", "--events", "ndjson"}))
+
+	env := map[string]string{
+		"INPUT_ID":                            "a675cc50",
+		"INPUT_COMMAND_ID":                    "cmd-1",
+		"INPUT_EVENTS":                        "none",
+		"INPUT_TIEAUTOMATIONSTATUSTOEXITCODE": "true",
+	}
+	if err := applyGithubInputs(cmd, func(name string) string { return env[name] }); err != nil {
+		t.Fatal(err)
+	}
+	if id != "a675cc50" || commandId != "cmd-1" || events != "ndjson" || !tie {
+		t.Errorf("expected empty and missing flags from inputs, given ones kept, got id=%s command-id=%s events=%s tie=%v", id, commandId, events, tie)
+	}
+
+	env = map[string]string{"INPUT_TIEAUTOMATIONSTATUSTOEXITCODE": "maybe"}
+	tie = false
+	cmd.Flags().Lookup("tieAutomationStatusToExitCode").Changed = false
+	if err := applyGithubInputs(cmd, func(name string) string { return env[name] }); err == nil {
+		t.Errorf("expected an error for a bad input")
+	}
+}
+
+func TestGithubSummary(t *testing.T) {
+	summary := newGithubSummary(githubRecords())
+	expected := GithubSummary{AutomationExecutionId: "parent-1", DocumentName: "Patch", Status: "Failed",
+		Succeeded: []string{"i-1"}, Failed: []string{"i-2"}, Pending: []string{"i-2"}}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected %+v, got %+v", expected, summary)
+	}
+}
+
+func TestWriteGithubOutputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output")
+	if err := writeGithubOutputs(path, newGithubSummary(githubRecords())); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"execution-id=parent-1\n", "status=Failed\n", "failed-targets=i-2\n", `summary={"AutomationExecutionId":"parent-1",`} {
+		if !strings.Contains(string(out), line) {
+			t.Errorf("expected %q in %s", line, out)
+		}
+	}
+}
+
+func TestWriteGithubAnnotations(t *testing.T) {
+	var out bytes.Buffer
+	_, children := githubRecords()
+	writeGithubAnnotations(&out, children)
+	expected := "::error title=PatchOne::db|1[i-2] Failed: step install failed:%0Aexit 1\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestWriteGithubStepSummary(t *testing.T) {
+	var out bytes.Buffer
+	parent, children := githubRecords()
+	if err := writeGithubStepSummary(&out, parent, children); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		"### Patch `parent-1`: Failed\n",
+		"| i-1 | web | PatchOne | Success | 1m35s |\n",
+		"| i-2 | db\\|1 | PatchOne | Failed |  |\n",
+		"| i-2 |  | Reboot | InProgress |  |\n",
+	} {
+		if !strings.Contains(out.String(), row) {
+			t.Errorf("expected %q in %s", row, out.String())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const DefaultIndexMaxAge = 24 * time.Hour
+
+// InstanceIndex is the local copy of the fleet and its tags that pattern searches run against.
+type InstanceIndex struct {
+	Created   time.Time
+	Profile   string
+	Region    string
+	Instances []ssmsearch.Instance
+}
+
+// cachePath is where sesame caches name for this command's profile and region.
+func (ssmCommand *SSMCommand) cachePath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sesame", fmt.Sprintf("%s-%s-%s.json", name, ssmCommand.profile(), ssmCommand.region)), nil
+}
+
+func (ssmCommand *SSMCommand) profile() string {
+	if ssmCommand.scope.Profile != "" {
+		return ssmCommand.scope.Profile
+	}
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return DefaultProfile
+}
+
+// loadIndex returns the scope's cached index unless it is older than maxAge or refresh is asked for, then it rebuilds it.
+func (ssmCommand *SSMCommand) loadIndex(ctx context.Context, maxAge time.Duration, refresh bool) (*InstanceIndex, error) {
+	p, err := ssmCommand.cachePath("index")
+	if err != nil {
+		return nil, err
+	}
+	if !refresh {
+		index, err := readIndex(p)
+		if err == nil && time.Since(index.Created) < maxAge {
+			return index, nil
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "building instance index: [%s]\n", p)
+	index := &InstanceIndex{Created: time.Now(), Profile: ssmCommand.profile(), Region: ssmCommand.region}
+	index.Instances, err = ssmCommand.searcher().SearchByTags(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return index, writeIndex(p, index)
+}
+
+func readIndex(p string) (*InstanceIndex, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	index := &InstanceIndex{}
+	return index, json.Unmarshal(b, index)
+}
+
+func writeIndex(p string, index *InstanceIndex) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0600)
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// junitTestSuites is the root of a JUnit XML report, as CI test dashboards read it.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite is one child execution, or Run Command invocation, on one target.
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Id        string          `xml:"id,attr,omitempty"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is one step execution, or plugin of a Run Command.
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// newJunitReport turns the tracked execution into one testsuite per child, nested children get their own suite,
+// with one testcase per step. Without children the parent is the only suite.
+func newJunitReport(parent ExecutionRecord, children []ExecutionRecord) junitTestSuites {
+	report := junitTestSuites{Name: parent.DocumentName}
+	var suites []junitTestSuite
+	var addSuites func(records []ExecutionRecord)
+	addSuites = func(records []ExecutionRecord) {
+		for _, record := range records {
+			suites = append(suites, newJunitTestSuite(record))
+			addSuites(record.Children)
+		}
+	}
+	addSuites(children)
+	if len(suites) == 0 {
+		suites = append(suites, newJunitTestSuite(parent))
+	}
+	for _, suite := range suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+	report.Suites = suites
+	report.Time = junitSeconds(parent.ExecutionStartTime, parent.ExecutionEndTime)
+	return report
+}
+
+func newJunitTestSuite(record ExecutionRecord) junitTestSuite {
+	name := record.DocumentName
+	if record.Target != "" {
+		name = fmt.Sprintf("%s %s[%s]", record.DocumentName, record.TargetName, record.Target)
+	}
+	suite := junitTestSuite{
+		Name: name,
+		Id:   record.key(),
+		Time: junitSeconds(record.ExecutionStartTime, record.ExecutionEndTime),
+	}
+	if record.ExecutionStartTime != nil {
+		suite.Timestamp = record.ExecutionStartTime.UTC().Format("2006-01-02T15:04:05")
+	}
+	for _, step := range record.Steps {
+		isCompleted, isSuccess := isCompletedAutomationStatus(types.AutomationExecutionStatus(step.Status))
+		testCase := junitTestCase{
+			Name:      step.StepName,
+			Classname: name,
+			Time:      junitSeconds(step.ExecutionStartTime, step.ExecutionEndTime),
+			SystemOut: junitCommandOutput(step.Commands),
+		}
+		junitResult(&testCase, step.Status, stepFailureMessage(step), isCompleted, isSuccess)
+		suite.add(testCase)
+	}
+	for _, command := range record.Commands {
+		// a tracked Run Command has no steps, each plugin is a testcase
+		isCompleted, isSuccess := isCompletedCommandStatus(command.Status)
+		testCase := junitTestCase{
+			Name:      command.PluginName,
+			Classname: name,
+			Time:      "0",
+			SystemOut: command.Output,
+		}
+		junitResult(&testCase, command.Status, record.FailureMessage, isCompleted, isSuccess)
+		suite.add(testCase)
+	}
+	if len(suite.TestCases) == 0 {
+		isCompleted, isSuccess := record.isCompleted()
+		testCase := junitTestCase{
+			Name:      record.DocumentName,
+			Classname: name,
+			Time:      suite.Time,
+		}
+		junitResult(&testCase, record.Status, record.FailureMessage, isCompleted, isSuccess)
+		suite.add(testCase)
+	}
+	return suite
+}
+
+func (suite *junitTestSuite) add(testCase junitTestCase) {
+	suite.Tests++
+	if testCase.Failure != nil {
+		suite.Failures++
+	}
+	if testCase.Skipped != nil {
+		suite.Skipped++
+	}
+	suite.TestCases = append(suite.TestCases, testCase)
+}
+
+// junitResult marks a failed testcase with its failure, and one still running when tracking ended as skipped.
+func junitResult(testCase *junitTestCase, status string, message string, isCompleted bool, isSuccess bool) {
+	switch {
+	case !isCompleted:
+		testCase.Skipped = &junitSkipped{Message: fmt.Sprintf("still %s when tracking ended", status)}
+	case !isSuccess:
+		if message == "" {
+			message = status
+		}
+		testCase.Failure = &junitFailure{Message: message, Type: status, Text: message}
+	}
+}
+
+// stepFailureMessage is the step's FailureMessage, or else what its FailureDetails say.
+func stepFailureMessage(step StepRecord) string {
+	if step.FailureMessage != "" || step.FailureDetails == nil {
+		return step.FailureMessage
+	}
+	details := step.FailureDetails
+	message := strings.TrimSpace(fmt.Sprintf("%s %s", aws.ToString(details.FailureType), aws.ToString(details.FailureStage)))
+	keys := make([]string, 0, len(details.Details))
+	for key := range details.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		message += fmt.Sprintf(" %s=%s", key, strings.Join(details.Details[key], ","))
+	}
+	return strings.TrimSpace(message)
+}
+
+func junitCommandOutput(commands []CommandRecord) string {
+	var out []string
+	for _, command := range commands {
+		out = append(out, fmt.Sprintf("[%s:%s] %s:\n%s", command.PluginName, command.CommandId, command.InstanceId, command.Output))
+	}
+	return strings.Join(out, "\n")
+}
+
+func junitSeconds(start *time.Time, end *time.Time) string {
+	if start == nil || end == nil || end.Before(*start) {
+		return "0"
+	}
+	return fmt.Sprintf("%.3f", end.Sub(*start).Seconds())
+}
+
+func writeJunit(path string, report junitTestSuites) error {
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(out, '\n')...), 0644)
+}
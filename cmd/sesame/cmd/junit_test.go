@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+func TestJunitReport(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	parent := ExecutionRecord{AutomationExecutionId: "parent-1", DocumentName: "Patch", Status: "Failed", ExecutionStartTime: &start, ExecutionEndTime: &end}
+	children := []ExecutionRecord{
+		{AutomationExecutionId: "child-1", DocumentName: "PatchOne", Status: "Success", Target: "i-1", TargetName: "web",
+			Steps: []StepRecord{{StepName: "install", Status: "Success", ExecutionStartTime: &start, ExecutionEndTime: &end,
+				Commands: []CommandRecord{{CommandId: "cmd-1", InstanceId: "i-1", PluginName: "runShellScript", Status: "Success", Output: "patched"}}}}},
+		{AutomationExecutionId: "child-2", DocumentName: "PatchOne", Status: "Failed", Target: "i-2",
+			Steps: []StepRecord{
+				{StepName: "install", Status: "Failed", FailureMessage: "exit status 1"},
+				{StepName: "reboot", Status: "Failed", FailureDetails: &types.FailureDetails{FailureType: aws.String("Verification"), FailureStage: aws.String("PreVerification"),
+					Details: map[string][]string{"ErrorCode": {"NotFound"}}}},
+				{StepName: "verify", Status: "Pending"},
+			},
+			Children: []ExecutionRecord{{AutomationExecutionId: "grandchild-1", DocumentName: "Reboot", Status: "Cancelled", FailureMessage: "cancelled"}}},
+	}
+	report := newJunitReport(parent, children)
+
+	if len(report.Suites) != 3 {
+		t.Fatalf("expected a suite per child, nested included, got %d", len(report.Suites))
+	}
+	if report.Tests != 5 || report.Failures != 3 || report.Skipped != 1 || report.Time != "90.000" {
+		t.Errorf("expected 5 tests, 3 failures, 1 skipped in 90.000s, got %d, %d, %d in %s", report.Tests, report.Failures, report.Skipped, report.Time)
+	}
+	passed := report.Suites[0].TestCases[0]
+	if report.Suites[0].Name != "PatchOne web[i-1]" || passed.Failure != nil || passed.Time != "90.000" || !strings.Contains(passed.SystemOut, "patched") {
+		t.Errorf("unexpected passing suite %+v", report.Suites[0])
+	}
+	failed := report.Suites[1].TestCases
+	if failed[0].Failure == nil || failed[0].Failure.Message != "exit status 1" {
+		t.Errorf("expected the step's FailureMessage, got %+v", failed[0].Failure)
+	}
+	if failed[1].Failure == nil || failed[1].Failure.Message != "Verification PreVerification ErrorCode=NotFound" {
+		t.Errorf("expected the step's FailureDetails, got %+v", failed[1].Failure)
+	}
+	if failed[2].Skipped == nil {
+		t.Errorf("expected a pending step to be skipped, got %+v", failed[2])
+	}
+	if grandchild := report.Suites[2].TestCases[0]; grandchild.Name != "Reboot" || grandchild.Failure == nil || grandchild.Failure.Message != "cancelled" {
+		t.Errorf("expected a stepless child to be one testcase, got %+v", grandchild)
+	}
+}
+
+func TestJunitReportWithoutChildren(t *testing.T) {
+	report := newJunitReport(ExecutionRecord{AutomationExecutionId: "parent-1", DocumentName: "Patch", Status: "Success"}, nil)
+	if len(report.Suites) != 1 || report.Tests != 1 || report.Failures != 0 {
+		t.Errorf("expected the parent as the only passing suite, got %+v", report)
+	}
+}
+
+func TestWriteJunit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	command := ExecutionRecord{CommandId: "cmd-1", DocumentName: "AWS-RunShellScript", Status: "Failed"}
+	invocation := ExecutionRecord{CommandId: "cmd-1", DocumentName: "AWS-RunShellScript", Status: "Failed", Target: "i-1",
+		Commands: []CommandRecord{{CommandId: "cmd-1", InstanceId: "i-1", PluginName: "aws:runShellScript", Status: "Failed", Output: "<oops> & more"}}}
+	if err := writeJunit(path, newJunitReport(command, []ExecutionRecord{invocation})); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), xml.Header) {
+		t.Errorf("expected an XML header, got %s", out)
+	}
+	var read junitTestSuites
+	if err := xml.Unmarshal(out, &read); err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Suites) != 1 || read.Suites[0].Id != "cmd-1/i-1" || read.Failures != 1 || read.Suites[0].TestCases[0].SystemOut != "<oops> & more" {
+		t.Errorf("unexpected report read back %+v", read)
+	}
+}
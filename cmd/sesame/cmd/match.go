@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+const fuzzySuffix = "~"
+const globChars = "*?["
+const minFuzzySimilarity = 0.6
+
+// A nicknameMatcher scores tag values against a search pattern, 0 means no match and 1 an exact match.
+//
+//	strange~   fuzzy, ranked by subsequence and edit distance
+//	Dr*        glob, see path.Match
+//	strange    case-insensitive substring
+type nicknameMatcher struct {
+	pattern string
+	isFuzzy bool
+	isGlob  bool
+}
+
+func newNicknameMatcher(pattern string) nicknameMatcher {
+	m := nicknameMatcher{pattern: strings.ToLower(pattern)}
+	if strings.HasSuffix(m.pattern, fuzzySuffix) {
+		m.isFuzzy = true
+		m.pattern = strings.TrimSuffix(m.pattern, fuzzySuffix)
+	} else if strings.ContainsAny(m.pattern, globChars) {
+		m.isGlob = true
+	}
+	return m
+}
+
+// isPatternSearch tells us the nickname can't be answered by an exact tag filter.
+func isPatternSearch(pattern string) bool {
+	return strings.HasSuffix(pattern, fuzzySuffix) || strings.ContainsAny(pattern, globChars)
+}
+
+func (m nicknameMatcher) score(value string) float64 {
+	candidate := strings.ToLower(value)
+	if m.isGlob {
+		if candidate == m.pattern {
+			return 1
+		}
+		if ok, _ := path.Match(m.pattern, candidate); ok {
+			return 0.9
+		}
+		return 0
+	}
+	if m.isFuzzy {
+		return fuzzyScore(m.pattern, candidate)
+	}
+	return substringScore(m.pattern, candidate)
+}
+
+func substringScore(pattern string, candidate string) float64 {
+	if pattern == "" || !strings.Contains(candidate, pattern) {
+		return 0
+	}
+	if pattern == candidate {
+		return 1
+	}
+	score := 0.5 + 0.4*float64(len(pattern))/float64(len(candidate))
+	if strings.HasPrefix(candidate, pattern) {
+		score += 0.05
+	}
+	return score
+}
+
+// fuzzyScore prefers substrings, then in-order subsequences, then values within a few typos of the pattern.
+func fuzzyScore(pattern string, candidate string) float64 {
+	if s := substringScore(pattern, candidate); s > 0 {
+		return s
+	}
+	if pattern == "" {
+		return 0
+	}
+	if isSubsequence(pattern, candidate) {
+		return 0.2 + 0.3*float64(len(pattern))/float64(len(candidate))
+	}
+	longest := len(pattern)
+	if len(candidate) > longest {
+		longest = len(candidate)
+	}
+	similarity := 1 - float64(levenshtein(pattern, candidate))/float64(longest)
+	if similarity < minFuzzySimilarity {
+		return 0
+	}
+	return 0.5 * similarity
+}
+
+func isSubsequence(pattern string, candidate string) bool {
+	p := []rune(pattern)
+	i := 0
+	for _, r := range candidate {
+		if i < len(p) && r == p[i] {
+			i++
+		}
+	}
+	return i == len(p)
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// suggest returns up to max distinct values closest to pattern, best first.
+func suggest(pattern string, values []string, max int) []string {
+	type scored struct {
+		value string
+		score float64
+	}
+	p := strings.ToLower(strings.TrimSuffix(pattern, fuzzySuffix))
+	seen := make(map[string]bool)
+	var candidates []scored
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if s := fuzzyScore(p, strings.ToLower(v)); s > 0 {
+			candidates = append(candidates, scored{v, s})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score == candidates[j].score {
+			return candidates[i].value < candidates[j].value
+		}
+		return candidates[i].score > candidates[j].score
+	})
+	var out []string
+	for i := 0; i < len(candidates) && i < max; i++ {
+		out = append(out, candidates[i].value)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestNicknameMatcher(t *testing.T) {
+	cases := []struct {
+		pattern string
+		value   string
+		isMatch bool
+	}{
+		{"strange", "DrStrange", true},
+		{"STRANGE", "drstrange", true},
+		{"strange", "IronMan", false},
+		{"Dr*", "DrStrange", true},
+		{"Dr*", "MrStrange", false},
+		{"dr?trange", "DrStrange", true},
+		{"strange~", "DrStrange", true},
+		{"drstange~", "DrStrange", true},
+		{"dstrng~", "DrStrange", true},
+		{"hulk~", "DrStrange", false},
+	}
+	for _, c := range cases {
+		score := newNicknameMatcher(c.pattern).score(c.value)
+		if (score > 0) != c.isMatch {
+			t.Errorf("pattern [%s] value [%s]: score %f, expected match %v", c.pattern, c.value, score, c.isMatch)
+		}
+	}
+}
+
+func TestNicknameMatcherRanksExactFirst(t *testing.T) {
+	m := newNicknameMatcher("strange~")
+	exact := m.score("Strange")
+	substring := m.score("DrStrange")
+	typo := m.score("Strnage")
+	if !(exact > substring && substring > typo && typo > 0) {
+		t.Errorf("unexpected ranking exact=%f substring=%f typo=%f", exact, substring, typo)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	got := suggest("drstange~", []string{"IronMan", "DrStrange", "DrStrange", "DrStrangelove"}, 5)
+	if len(got) != 2 || got[0] != "DrStrange" {
+		t.Errorf("unexpected suggestions %v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const OutputTable = "table"
+const OutputJson = "json"
+const OutputYaml = "yaml"
+const OutputNdjson = "ndjson"
+
+var outputFormats = []string{OutputTable, OutputJson, OutputYaml, OutputNdjson}
+
+var outputFlag string
+var formatFlag string
+
+func validateOutputFlag(output string) error {
+	for _, f := range outputFormats {
+		if output == f {
+			return nil
+		}
+	}
+	return &SesameError{msg: fmt.Sprintf("unknown output [%s], expected one of %v", output, outputFormats)}
+}
+
+// validateOutputFlags checks --output and compiles --format early, before any AWS call is made.
+func validateOutputFlags() error {
+	if err := validateOutputFlag(outputFlag); err != nil {
+		return err
+	}
+	if formatFlag != "" {
+		if _, err := parseFormat(formatFlag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMachineOutput is true when stdout carries json, yaml, ndjson or --format output for a script to read.
+func isMachineOutput() bool {
+	return formatFlag != "" || outputFlag != OutputTable
+}
+
+// isOutputRequested is true when --output or --format was given, for commands that are not a table by default.
+func isOutputRequested(cmd *cobra.Command) bool {
+	return formatFlag != "" || cmd.Flags().Changed("output")
+}
+
+// progressOut is where progress chatter goes, stderr when stdout has to stay parseable, above the status block at a terminal.
+func progressOut() io.Writer {
+	if liveOut != nil {
+		return liveOut
+	}
+	if isMachineOutput() || trackomateEvents != "" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// reportOut is stderr, where warnings and questions go, clearing the status block first while one is drawn.
+func reportOut() io.Writer {
+	if liveOut != nil {
+		return liveOut.to(os.Stderr)
+	}
+	return os.Stderr
+}
+
+// writeOutput writes items in the --output format, or each item through the --format template.
+// table writes the default, human readable, form.
+func writeOutput(w io.Writer, items []interface{}, table func(io.Writer) error) error {
+	if formatFlag != "" {
+		tmpl, err := parseFormat(formatFlag)
+		if err != nil {
+			return err
+		}
+		return writeTemplate(w, tmpl, items)
+	}
+	switch outputFlag {
+	case OutputJson:
+		return writeJson(w, items)
+	case OutputYaml:
+		return writeYaml(w, items)
+	case OutputNdjson:
+		return writeNdjson(w, items)
+	}
+	return table(w)
+}
+
+// writeJson writes v as a single indented JSON document.
+func writeJson(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYaml writes v as a YAML document with the same field names and order as its JSON.
+func writeYaml(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the flow style and quoting YAML keeps from parsing JSON, the encoder quotes where it must.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// writeNdjson writes each item as one compact JSON object per line.
+func writeNdjson(w io.Writer, items []interface{}) error {
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFormat compiles a --format template, missing map keys such as {{.Tags.Nickname}} print as empty.
+func parseFormat(format string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"join": strings.Join,
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}
+	tmpl, err := template.New("format").Funcs(funcs).Option("missingkey=zero").Parse(format)
+	if err != nil {
+		return nil, &SesameError{msg: fmt.Sprintf("bad --format template: %v", err)}
+	}
+	return tmpl, nil
+}
+
+// writeTemplate writes each item through tmpl, one item per line.
+func writeTemplate(w io.Writer, tmpl *template.Template, items []interface{}) error {
+	for _, item := range items {
+		var line bytes.Buffer
+		if err := tmpl.Execute(&line, item); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(line.Bytes(), []byte("\n")) {
+			line.WriteByte('\n')
+		}
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+)
+
+func TestWriteYaml(t *testing.T) {
+	items := []interface{}{
+		AliasRecord{Name: "db", Targets: []string{"mi-01d856ea25bf2f111", "Env=prod"}},
+		AliasRecord{Name: "true", Targets: []string{"8080"}},
+	}
+	var out bytes.Buffer
+	if err := writeYaml(&out, items); err != nil {
+		t.Fatal(err)
+	}
+	expected := `- Name: db
+  Targets:
+    - mi-01d856ea25bf2f111
+    - Env=prod
+- Name: "true"
+  Targets:
+    - "8080"
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	items := []interface{}{
+		SearchResult{Instance: ssmsearch.Instance{InstanceId: "mi-1", Tags: map[string]string{"Nickname": "DrStrange"}}},
+		SearchResult{Instance: ssmsearch.Instance{InstanceId: "mi-2"}},
+	}
+	cases := []struct {
+		format   string
+		expected string
+	}{
+		{"{{.InstanceId}} {{.Tags.Nickname}}", "mi-1 DrStrange\nmi-2 \n"},
+		{"{{.InstanceId}}\n", "mi-1\nmi-2\n"},
+		{"{{json .Tags}}", "{\"Nickname\":\"DrStrange\"}\nnull\n"},
+	}
+	for _, c := range cases {
+		tmpl, err := parseFormat(c.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := writeTemplate(&out, tmpl, items); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.expected {
+			t.Errorf("[%s]: expected %q, got %q", c.format, c.expected, out.String())
+		}
+	}
+}
+
+func TestValidateOutputFlags(t *testing.T) {
+	defer func() { outputFlag, formatFlag = OutputTable, "" }()
+	cases := []struct {
+		output  string
+		format  string
+		isValid bool
+	}{
+		{OutputTable, "", true},
+		{OutputYaml, "", true},
+		{"xml", "", false},
+		{OutputTable, "{{.InstanceId}}", true},
+		{OutputTable, "{{.InstanceId", false},
+	}
+	for _, c := range cases {
+		outputFlag, formatFlag = c.output, c.format
+		err := validateOutputFlags()
+		if (err == nil) != c.isValid {
+			t.Errorf("[%s %s]: expected valid=%v, got %v", c.output, c.format, c.isValid, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// describeAllExecutions reads every page of DescribeAutomationExecutions, rate controlled automations
+// easily go past the 50 executions a page holds.
+func describeAllExecutions(ctx context.Context, client ssm.DescribeAutomationExecutionsAPIClient, input *ssm.DescribeAutomationExecutionsInput) ([]types.AutomationExecutionMetadata, error) {
+	var executions []types.AutomationExecutionMetadata
+	paginator := ssm.NewDescribeAutomationExecutionsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, page.AutomationExecutionMetadataList...)
+	}
+	return executions, nil
+}
+
+// describeAllStepExecutions reads every page of DescribeAutomationStepExecutions.
+func describeAllStepExecutions(ctx context.Context, client ssm.DescribeAutomationStepExecutionsAPIClient, input *ssm.DescribeAutomationStepExecutionsInput) ([]types.StepExecution, error) {
+	var steps []types.StepExecution
+	paginator := ssm.NewDescribeAutomationStepExecutionsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, page.StepExecutions...)
+	}
+	return steps, nil
+}
+
+// listAllCommandInvocations reads every page of ListCommandInvocations, one per instance the command was sent to.
+func listAllCommandInvocations(ctx context.Context, client ssm.ListCommandInvocationsAPIClient, input *ssm.ListCommandInvocationsInput) ([]types.CommandInvocation, error) {
+	var invocations []types.CommandInvocation
+	paginator := ssm.NewListCommandInvocationsPaginator(client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		invocations = append(invocations, page.CommandInvocations...)
+	}
+	return invocations, nil
+}
+
+// stepInstanceId is the instance to filter a step's command invocations by, from the step's InstanceIds input,
+// or "" when the step targeted several instances and all invocations are wanted.
+func stepInstanceId(instanceIdsInput string) string {
+	var instanceIds []string
+	if err := json.Unmarshal([]byte(instanceIdsInput), &instanceIds); err != nil {
+		return instanceIdsInput
+	}
+	if len(instanceIds) != 1 {
+		return ""
+	}
+	return instanceIds[0]
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/madflojo/tasks"
+)
+
+const DefaultPollMin = 2 * time.Second
+const DefaultPollMax = 30 * time.Second
+
+const OnTimeoutFail = "fail"
+const OnTimeoutLeave = "leave"
+const OnTimeoutStop = "stop"
+
+var onTimeoutActions = []string{OnTimeoutFail, OnTimeoutLeave, OnTimeoutStop}
+
+// backoff doubles the poll interval from min up to max, each interval is jittered down by up to half
+// so many trackomates started together don't poll in lock step.
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+	jitter  func(time.Duration) time.Duration
+}
+
+func newBackoff(min time.Duration, max time.Duration) *backoff {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &backoff{min: min, max: max, jitter: func(d time.Duration) time.Duration {
+		return d/2 + time.Duration(random.Int63n(int64(d/2)+1))
+	}}
+}
+
+func (poll *backoff) next() time.Duration {
+	if poll.current == 0 {
+		poll.current = poll.min
+	} else {
+		poll.current *= 2
+	}
+	if poll.current > poll.max {
+		poll.current = poll.max
+	}
+	interval := poll.jitter(poll.current)
+	if interval <= 0 {
+		interval = poll.current
+	}
+	return interval
+}
+
+func validatePolling(pollMin time.Duration, pollMax time.Duration, onTimeout string) error {
+	if pollMin <= 0 || pollMax < pollMin {
+		return &SesameError{msg: fmt.Sprintf("poll intervals must be positive with pollMin [%s] <= pollMax [%s]", pollMin, pollMax)}
+	}
+	for _, action := range onTimeoutActions {
+		if onTimeout == action {
+			return nil
+		}
+	}
+	return &SesameError{msg: fmt.Sprintf("unknown on-timeout [%s], expected one of %v", onTimeout, onTimeoutActions)}
+}
+
+// pollState is whether polling was stopped, a poll running as the scheduler stops would otherwise schedule its
+// next one on the stopped scheduler and keep polling. scheduled are the polls added and not done yet, counted here
+// as the scheduler's own task list can't be read while its tasks come and go.
+type pollState struct {
+	mu        sync.Mutex
+	isStopped bool
+	scheduled map[string]bool
+}
+
+func newPollState() *pollState {
+	return &pollState{scheduled: make(map[string]bool)}
+}
+
+// pending is how many polls are scheduled or running, a poll scheduling its next one counts as one throughout.
+func (polling *pollState) pending() int {
+	polling.mu.Lock()
+	defer polling.mu.Unlock()
+	return len(polling.scheduled)
+}
+
+// schedulePoll runs check once the next backed off interval passed, and again after each longer one, until check
+// is done or polling was stopped.
+func (trackomate *Trackomate) schedulePoll(poll *backoff, check func() bool) {
+	trackomate.polling.mu.Lock()
+	defer trackomate.polling.mu.Unlock()
+	if trackomate.polling.isStopped {
+		return
+	}
+	var id string
+	id, err := trackomate.scheduler.Add(&tasks.Task{
+		Interval: poll.next(),
+		RunOnce:  true,
+		TaskFunc: func() error {
+			if !check() {
+				trackomate.schedulePoll(poll, check)
+			}
+			trackomate.polling.mu.Lock()
+			defer trackomate.polling.mu.Unlock()
+			delete(trackomate.polling.scheduled, id)
+			return nil
+		},
+	})
+	exitOnError(err)
+	trackomate.polling.scheduled[id] = true
+}
+
+// stopPolling stops the scheduler for good, a poll running now doesn't schedule another.
+func (trackomate *Trackomate) stopPolling() {
+	trackomate.polling.mu.Lock()
+	defer trackomate.polling.mu.Unlock()
+	trackomate.polling.isStopped = true
+	for id := range trackomate.polling.scheduled {
+		trackomate.scheduler.Del(id)
+		delete(trackomate.polling.scheduled, id)
+	}
+}
+
+// timedOut applies --on-timeout once --timeout passed with the execution still running.
+func (trackomate *Trackomate) timedOut() {
+	_, _ = fmt.Fprintf(progressOut(), "  REPORT: Timed out after %s, on-timeout=%s \n", trackomate.timeout, trackomate.onTimeout)
+	switch trackomate.onTimeout {
+	case OnTimeoutStop:
+		stopType := types.StopTypeCancel
+		if trackomate.cancelOnExit == CancelOnExitComplete {
+			stopType = types.StopTypeComplete
+		}
+		trackomate.stopExecution(stopType)
+	}
+	trackomate.isTimedOut = true
+}
+
+// skipPoll lets the run go on to the next poll after a transient error the SDK's retries couldn't get past,
+// any other error still ends the run.
+func (trackomate *Trackomate) skipPoll(err error) {
+	if !isTransientError(err) {
+		exitOnError(err)
+	}
+	atomic.AddInt64(&trackomate.skippedPolls, 1)
+	_, _ = fmt.Fprintf(reportOut(), "  REPORT: skipping a poll, %s error: %v\n", classifyError(err), err)
+}
+
+func (trackomate *Trackomate) skipped() int {
+	return int(atomic.LoadInt64(&trackomate.skippedPolls))
+}
+
+// stop cancels, or completes, the tracked automation execution, or cancels the Run Command.
+func (trackomate *Trackomate) stop(stopType types.StopType) error {
+	if trackomate.commandId != "" {
+		_, err := trackomate.svc.CancelCommand(context.Background(), &ssm.CancelCommandInput{CommandId: &trackomate.commandId})
+		return err
+	}
+	_, err := trackomate.svc.StopAutomationExecution(context.Background(), &ssm.StopAutomationExecutionInput{
+		AutomationExecutionId: &trackomate.automationExecutionId,
+		Type:                  stopType,
+	})
+	return err
+}
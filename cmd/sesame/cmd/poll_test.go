@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	poll := newBackoff(2*time.Second, 30*time.Second)
+	poll.jitter = func(d time.Duration) time.Duration { return d }
+	var intervals []time.Duration
+	for i := 0; i < 6; i++ {
+		intervals = append(intervals, poll.next())
+	}
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	if !reflect.DeepEqual(intervals, expected) {
+		t.Errorf("expected %v, got %v", expected, intervals)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	poll := newBackoff(2*time.Second, 30*time.Second)
+	for i := 0; i < 20; i++ {
+		interval := poll.next()
+		if interval < poll.current/2 || interval > poll.current {
+			t.Errorf("poll %d: interval %s outside [%s, %s]", i, interval, poll.current/2, poll.current)
+		}
+	}
+}
+
+func TestValidatePolling(t *testing.T) {
+	cases := []struct {
+		pollMin   time.Duration
+		pollMax   time.Duration
+		onTimeout string
+		isValid   bool
+	}{
+		{DefaultPollMin, DefaultPollMax, OnTimeoutFail, true},
+		{time.Second, time.Second, OnTimeoutStop, true},
+		{DefaultPollMin, DefaultPollMax, OnTimeoutLeave, true},
+		{0, DefaultPollMax, OnTimeoutFail, false},
+		{time.Minute, time.Second, OnTimeoutFail, false},
+		{DefaultPollMin, DefaultPollMax, "explode", false},
+	}
+	for _, c := range cases {
+		err := validatePolling(c.pollMin, c.pollMax, c.onTimeout)
+		if (err == nil) != c.isValid {
+			t.Errorf("[%s %s %s]: expected valid=%v, got %v", c.pollMin, c.pollMax, c.onTimeout, c.isValid, err)
+		}
+	}
+}
+
+func TestStopPollingEndsPolls(t *testing.T) {
+	trackomate := newTrackomate("", -1)
+	var checks int64
+	started := make(chan bool, 1)
+	trackomate.schedulePoll(newBackoff(time.Millisecond, time.Millisecond), func() bool {
+		if atomic.AddInt64(&checks, 1) == 1 {
+			started <- true
+			// the scheduler stops while this poll runs
+			time.Sleep(20 * time.Millisecond)
+		}
+		return false
+	})
+	<-started
+	trackomate.stopPolling()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&checks); n != 1 || trackomate.polling.pending() != 0 {
+		t.Errorf("expected the running poll to be the last, got %d polls and %d scheduled", n, trackomate.polling.pending())
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var isVerbose bool
+
+// liveOut is the status block redrawn in place at a terminal, progressOut writes through it while trackomate runs.
+var liveOut *liveBlock
+
+const liveChildLines = 8
+
+// progressPrinter prints what changed since the last poll: a new child, step or status, and output not printed yet.
+// A verbose printer prints everything on every poll, like trackomate always did.
+type progressPrinter struct {
+	mu      sync.Mutex
+	verbose bool
+	seen    map[string]string
+	start   time.Time
+}
+
+func newProgressPrinter(verbose bool) *progressPrinter {
+	return &progressPrinter{verbose: verbose, seen: make(map[string]string), start: time.Now()}
+}
+
+// changed records state as the latest of key, it is true when it differs from the previous one.
+func (progress *progressPrinter) changed(key string, state string) bool {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	previous, ok := progress.seen[key]
+	progress.seen[key] = state
+	return progress.verbose || !ok || previous != state
+}
+
+// printf prints the line when key moved to a new state.
+func (progress *progressPrinter) printf(key string, state string, format string, args ...interface{}) {
+	if progress.changed(key, state) {
+		_, _ = fmt.Fprintf(progressOut(), format, args...)
+	}
+}
+
+// output prints the part of a plugin's output that wasn't printed yet, all of it if it was replaced, e.g. by the
+// full output, and an empty output once the plugin completed.
+func (progress *progressPrinter) output(what string, command CommandRecord) {
+	progress.mu.Lock()
+	printed := command
+	if !progress.verbose {
+		printed.Output = newOutput(progress.seen[command.key()+"/stdout"], command.Output)
+		if progress.seen[command.key()+"/stderr"] == command.Stderr {
+			printed.Stderr = ""
+		}
+	}
+	_, wasEmpty := progress.seen[command.key()+"/empty"]
+	isCompleted, _ := isCompletedCommandStatus(command.Status)
+	isEmpty := command.Output == "" && isCompleted
+	if isEmpty {
+		progress.seen[command.key()+"/empty"] = command.Status
+	}
+	progress.seen[command.key()+"/stdout"] = command.Output
+	progress.seen[command.key()+"/stderr"] = command.Stderr
+	progress.mu.Unlock()
+
+	if printed.Output != "" || printed.Stderr != "" || (isEmpty && (progress.verbose || !wasEmpty)) {
+		printCommandOutput(what, printed)
+	}
+}
+
+// newOutput is what output added to previous, or all of it when it doesn't start with previous.
+func newOutput(previous string, output string) string {
+	if previous != "" && strings.HasPrefix(output, previous) {
+		return strings.TrimPrefix(strings.TrimPrefix(output, previous), "\n")
+	}
+	return output
+}
+
+// redraw replaces the status block at a terminal with how the children stand now.
+func (progress *progressPrinter) redraw(parent ExecutionRecord, children []ExecutionRecord) {
+	if liveOut == nil {
+		return
+	}
+	liveOut.redraw(statusBlock(parent, children, time.Since(progress.start)))
+}
+
+// statusBlock is a line counting the children and one for each still pending, with the step it is on.
+func statusBlock(parent ExecutionRecord, children []ExecutionRecord, elapsed time.Duration) []string {
+	succeeded, failed, pending := countChildren(children)
+	isCompleted, isSuccess := parent.isCompleted()
+	lines := []string{fmt.Sprintf("── %s [%s] %d succeeded, %d failed, %d pending · %s",
+		colorStatus(parent.Status, isCompleted, isSuccess), parent.DocumentName, succeeded, failed, pending, elapsed.Truncate(time.Second))}
+	var running []string
+	eachChild(children, func(child ExecutionRecord) {
+		if isCompleted, _ := child.isCompleted(); isCompleted {
+			return
+		}
+		line := fmt.Sprintf("   %s[%s] %s: %s", child.TargetName, child.Target, child.DocumentName, colorStatus(child.Status, false, false))
+		if step := currentStep(child.Steps); step != "" {
+			line += " " + step
+		}
+		running = append(running, line)
+	})
+	if len(running) > liveChildLines {
+		running = append(running[:liveChildLines], fmt.Sprintf("   … and %d more", len(running)-liveChildLines))
+	}
+	return append(lines, running...)
+}
+
+// currentStep is the name of the step that started and hasn't finished yet, if any.
+func currentStep(steps []StepRecord) string {
+	for _, step := range steps {
+		if isStepStarted(step.Status) && !isStepFinished(step.Status) {
+			return step.StepName
+		}
+	}
+	return ""
+}
+
+// liveBlock keeps a few status lines at the bottom of a terminal. Anything written through it goes above them,
+// they are drawn again on the next redraw.
+type liveBlock struct {
+	mu    sync.Mutex
+	out   io.Writer
+	lines int
+	// isHeld keeps the block off the terminal while a question waits for its answer below it.
+	isHeld bool
+}
+
+func newLiveBlock(out io.Writer) *liveBlock {
+	return &liveBlock{out: out}
+}
+
+func (live *liveBlock) Write(p []byte) (int, error) {
+	return live.to(live.out).Write(p)
+}
+
+// to writes to out, the block's terminal on another stream such as stderr, clearing the block first.
+func (live *liveBlock) to(out io.Writer) io.Writer {
+	return blockWriter{live: live, out: out}
+}
+
+type blockWriter struct {
+	live *liveBlock
+	out  io.Writer
+}
+
+func (w blockWriter) Write(p []byte) (int, error) {
+	w.live.mu.Lock()
+	defer w.live.mu.Unlock()
+	w.live.clear()
+	return w.out.Write(p)
+}
+
+func (live *liveBlock) redraw(block []string) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	if live.isHeld {
+		return
+	}
+	live.clear()
+	width := terminalWidth(live.out)
+	for _, line := range block {
+		// a line wrapping would throw the count off
+		_, _ = fmt.Fprintln(live.out, clip(line, width-1))
+	}
+	live.lines = len(block)
+}
+
+// hold clears the block and keeps it off until release, a question asked would otherwise be erased with it.
+func (live *liveBlock) hold() {
+	if live == nil {
+		return
+	}
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	live.clear()
+	live.isHeld = true
+}
+
+func (live *liveBlock) release() {
+	if live == nil {
+		return
+	}
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	live.isHeld = false
+}
+
+// clear moves back up to the first line of the block and erases down from there.
+func (live *liveBlock) clear() {
+	if live.lines > 0 {
+		_, _ = fmt.Fprintf(live.out, "\033[%dA\033[J", live.lines)
+		live.lines = 0
+	}
+}
+
+// close erases the block for good, progress is written straight out again.
+func (live *liveBlock) close() {
+	if live == nil {
+		return
+	}
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	live.clear()
+	liveOut = nil
+}
+
+// clip cuts line to width visible characters, the color escapes don't count and are closed if cut.
+func clip(line string, width int) string {
+	var b strings.Builder
+	visible, isEscape := 0, false
+	for _, r := range line {
+		switch {
+		case r == '\033':
+			isEscape = true
+		case isEscape:
+			isEscape = r != 'm'
+		case visible == width:
+			return b.String() + "\033[0m"
+		default:
+			visible++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// terminalWidth is how many columns the terminal out is wide, read on every redraw to follow a resize, 80 when
+// out isn't a terminal.
+func terminalWidth(out io.Writer) int {
+	if f, ok := out.(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 80
+}
+
+// isTerminal is true when w is a terminal, the status block is only drawn there.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureProgress sends progressOut to a buffer for the length of the test.
+func captureProgress(t *testing.T) *bytes.Buffer {
+	var out bytes.Buffer
+	liveOut = newLiveBlock(&out)
+	t.Cleanup(func() { liveOut = nil })
+	return &out
+}
+
+func TestProgressPrinterPrintsTransitions(t *testing.T) {
+	out := captureProgress(t)
+	progress := newProgressPrinter(false)
+	for _, status := range []string{"InProgress", "InProgress", "Success", "Success"} {
+		progress.printf("exec-1", status, "CHILD: %s\n", status)
+	}
+	if out.String() != "CHILD: InProgress\nCHILD: Success\n" {
+		t.Errorf("expected each status once, got %q", out.String())
+	}
+
+	out.Reset()
+	verbose := newProgressPrinter(true)
+	for i := 0; i < 3; i++ {
+		verbose.printf("exec-1", "InProgress", "CHILD: %s\n", "InProgress")
+	}
+	if strings.Count(out.String(), "CHILD") != 3 {
+		t.Errorf("expected verbose to print every poll, got %q", out.String())
+	}
+}
+
+func TestProgressPrinterOutput(t *testing.T) {
+	out := captureProgress(t)
+	progress := newProgressPrinter(false)
+	command := CommandRecord{CommandId: "cmd-1", InstanceId: "i-1", PluginName: "aws:runShellScript", Status: "InProgress"}
+	polls := []struct {
+		status   string
+		output   string
+		expected string
+	}{
+		{"InProgress", "", ""},
+		{"InProgress", "line 1", "line 1"},
+		{"InProgress", "line 1", ""},
+		{"InProgress", "line 1\nline 2", "line 2"},
+		{"Success", "line 1\nline 2", ""},
+		{"Success", "full output", "full output"},
+	}
+	for i, poll := range polls {
+		out.Reset()
+		command.Status, command.Output = poll.status, poll.output
+		progress.output(" TARGET", command)
+		if poll.expected == "" && out.Len() > 0 || !strings.Contains(out.String(), poll.expected) {
+			t.Errorf("[%d]: expected %q printed, got %q", i, poll.expected, out.String())
+		}
+	}
+
+	out.Reset()
+	empty := CommandRecord{CommandId: "cmd-1", InstanceId: "i-2", PluginName: "aws:runShellScript", Status: "Success"}
+	progress.output(" TARGET", empty)
+	progress.output(" TARGET", empty)
+	if strings.Count(out.String(), "-empty-") != 1 {
+		t.Errorf("expected an empty output once, got %q", out.String())
+	}
+}
+
+func TestLiveBlock(t *testing.T) {
+	var out bytes.Buffer
+	live := newLiveBlock(&out)
+	live.redraw([]string{"── 1 pending", "   web-1[i-1]"})
+	_, _ = live.Write([]byte("CHILD: Success\n"))
+	live.redraw([]string{"── 1 succeeded"})
+	live.close()
+	expected := "── 1 pending\n   web-1[i-1]\n\033[2A\033[JCHILD: Success\n── 1 succeeded\n\033[1A\033[J"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestLiveBlockHold(t *testing.T) {
+	var out, stderr bytes.Buffer
+	live := newLiveBlock(&out)
+	live.redraw([]string{"── 1 pending"})
+	_, _ = live.to(&stderr).Write([]byte("  REPORT: skipping a poll\n"))
+	live.redraw([]string{"── 1 pending"})
+	live.hold()
+	// a poll while a question is asked doesn't draw the block under it
+	live.redraw([]string{"── 1 pending"})
+	live.release()
+	live.redraw([]string{"── 1 succeeded"})
+	expected := "── 1 pending\n\033[1A\033[J── 1 pending\n\033[1A\033[J── 1 succeeded\n"
+	if out.String() != expected || stderr.String() != "  REPORT: skipping a poll\n" {
+		t.Errorf("expected %q and the report on stderr, got %q and %q", expected, out.String(), stderr.String())
+	}
+}
+
+func TestStatusBlock(t *testing.T) {
+	parent := ExecutionRecord{AutomationExecutionId: "exec-1", DocumentName: "Patch", Status: "InProgress"}
+	children := []ExecutionRecord{
+		{AutomationExecutionId: "exec-2", Target: "i-1", TargetName: "web-1", DocumentName: "Patch", Status: "Success"},
+		{AutomationExecutionId: "exec-3", Target: "i-2", TargetName: "web-2", DocumentName: "Patch", Status: "InProgress",
+			Steps: []StepRecord{{StepName: "scan", Status: "Success"}, {StepName: "install", Status: "InProgress"}}},
+	}
+	block := statusBlock(parent, children, 90*time.Second)
+	if len(block) != 2 || !strings.Contains(block[0], "1 succeeded, 0 failed, 1 pending · 1m30s") || !strings.Contains(block[1], "web-2[i-2]") || !strings.HasSuffix(block[1], " install") {
+		t.Errorf("unexpected block %q", block)
+	}
+}
+
+func TestClip(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected string
+	}{
+		{"short", "short"},
+		{"abcdefgh", "abcde\033[0m"},
+		{"\033[33mabcdefgh\033[0m", "\033[33mabcde\033[0m"},
+	}
+	for _, c := range cases {
+		if clipped := clip(c.line, 5); clipped != c.expected {
+			t.Errorf("[%q]: expected %q, got %q", c.line, c.expected, clipped)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+const DefaultApiRate = 5.0
+const DefaultMaxAttempts = 8
+
+const ErrorClassFatal = "fatal"
+const ErrorClassTransient = "transient"
+const ErrorClassThrottled = "throttled"
+const ErrorClassAuth = "auth"
+const ErrorClassNotFound = "notfound"
+
+var authErrorCodes = map[string]bool{
+	"AccessDeniedException":       true,
+	"AccessDenied":                true,
+	"UnauthorizedOperation":       true,
+	"UnrecognizedClientException": true,
+	"InvalidClientTokenId":        true,
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"AuthFailure":                 true,
+	"SignatureDoesNotMatch":       true,
+}
+
+var notFoundErrorCodes = map[string]bool{
+	"AutomationExecutionNotFoundException": true,
+	"InvalidCommandId":                     true,
+	"InvalidInstanceId":                    true,
+	"InvalidDocument":                      true,
+	"InvalidDocumentVersion":               true,
+	"InvalidInstanceID.NotFound":           true,
+}
+
+var apiRate float64
+var apiLimiter *rateLimiter
+var apiLimiterOnce sync.Once
+
+// apiRetries counts every retried AWS call of the run, from every client.
+var apiRetries int64
+
+// classifyError sorts an AWS error by what can be done about it, transient and throttled errors
+// are worth another poll once the SDK's own retries ran out.
+func classifyError(err error) string {
+	// no credentials to sign the call with, or no such profile to find them in
+	var signingErr *v4.SigningError
+	var profileErr config.SharedConfigProfileNotExistError
+	if errors.As(err, &signingErr) || errors.As(err, &profileErr) {
+		return ErrorClassAuth
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if authErrorCodes[apiErr.ErrorCode()] {
+			return ErrorClassAuth
+		}
+		if notFoundErrorCodes[apiErr.ErrorCode()] {
+			return ErrorClassNotFound
+		}
+	}
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return ErrorClassThrottled
+	}
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary {
+		return ErrorClassTransient
+	}
+	return ErrorClassFatal
+}
+
+func isTransientError(err error) bool {
+	class := classifyError(err)
+	return class == ErrorClassTransient || class == ErrorClassThrottled
+}
+
+// countingRetryer is the SDK's adaptive retryer, which also slows down on throttling, counting the retries it makes.
+type countingRetryer struct {
+	aws.RetryerV2
+}
+
+func newRetryer() aws.Retryer {
+	return countingRetryer{retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+		o.StandardOptions = append(o.StandardOptions, func(so *retry.StandardOptions) {
+			so.MaxAttempts = DefaultMaxAttempts
+		})
+	})}
+}
+
+func (retryer countingRetryer) RetryDelay(attempt int, opErr error) (time.Duration, error) {
+	atomic.AddInt64(&apiRetries, 1)
+	return retryer.RetryerV2.RetryDelay(attempt, opErr)
+}
+
+func retriedCalls() int {
+	return int(atomic.LoadInt64(&apiRetries))
+}
+
+// rateLimiter spaces calls evenly at rate per second, letting a burst of calls through after a quiet spell.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	return &rateLimiter{interval: interval, burst: time.Duration(burst-1) * interval}
+}
+
+// reserve books the next free slot and returns how long to wait for it, a nil rateLimiter never waits.
+func (limiter *rateLimiter) reserve(now time.Time) time.Duration {
+	if limiter == nil {
+		return 0
+	}
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if earliest := now.Add(-limiter.burst); limiter.next.Before(earliest) {
+		limiter.next = earliest
+	}
+	at := limiter.next
+	limiter.next = limiter.next.Add(limiter.interval)
+	return at.Sub(now)
+}
+
+func (limiter *rateLimiter) wait(ctx context.Context) error {
+	delay := limiter.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sharedLimiter is the one limiter every client of the run, in every scope, waits on.
+func sharedLimiter() *rateLimiter {
+	apiLimiterOnce.Do(func() {
+		apiLimiter = newRateLimiter(apiRate, int(apiRate)+1)
+	})
+	return apiLimiter
+}
+
+// addRateLimit makes every attempt, retries included, wait for the shared limiter.
+func addRateLimit(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("SesameRateLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if err := sharedLimiter().wait(ctx); err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
+		}
+		return next.HandleFinalize(ctx, in)
+	}), middleware.After)
+}
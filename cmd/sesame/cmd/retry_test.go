@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err         error
+		class       string
+		isTransient bool
+	}{
+		{&smithy.GenericAPIError{Code: "ThrottlingException"}, ErrorClassThrottled, true},
+		{&smithy.GenericAPIError{Code: "RequestLimitExceeded"}, ErrorClassThrottled, true},
+		{&smithy.GenericAPIError{Code: "RequestTimeoutException"}, ErrorClassTransient, true},
+		{&smithy.GenericAPIError{Code: "AccessDeniedException"}, ErrorClassAuth, false},
+		{&smithy.GenericAPIError{Code: "ExpiredTokenException"}, ErrorClassAuth, false},
+		{&smithy.GenericAPIError{Code: "AutomationExecutionNotFoundException"}, ErrorClassNotFound, false},
+		{&smithy.GenericAPIError{Code: "ValidationException"}, ErrorClassFatal, false},
+		{errors.New("boom"), ErrorClassFatal, false},
+	}
+	for _, c := range cases {
+		if class := classifyError(c.err); class != c.class {
+			t.Errorf("[%v]: expected class %s, got %s", c.err, c.class, class)
+		}
+		if isTransient := isTransientError(c.err); isTransient != c.isTransient {
+			t.Errorf("[%v]: expected transient=%v, got %v", c.err, c.isTransient, isTransient)
+		}
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, 2)
+	now := time.Unix(1000, 0)
+	var delays []time.Duration
+	for i := 0; i < 4; i++ {
+		delays = append(delays, limiter.reserve(now))
+	}
+	// the burst of two goes at once, the rest half a second apart
+	expected := []time.Duration{-500 * time.Millisecond, 0, 500 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected delays %v, got %v", expected, delays)
+	}
+	if delay := limiter.reserve(now.Add(time.Minute)); delay > 0 {
+		t.Errorf("expected no delay after a quiet spell, got %s", delay)
+	}
+	var none *rateLimiter
+	if delay := none.reserve(now); delay != 0 {
+		t.Errorf("expected a nil limiter never to wait, got %s", delay)
+	}
+	if newRateLimiter(0, 1) != nil {
+		t.Errorf("expected no limiter for a rate of 0")
+	}
+}
+
+func TestCountingRetryer(t *testing.T) {
+	before := retriedCalls()
+	retryer := newRetryer()
+	if retryer.MaxAttempts() != DefaultMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", DefaultMaxAttempts, retryer.MaxAttempts())
+	}
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException"}
+	if !retryer.IsErrorRetryable(throttled) {
+		t.Errorf("expected throttling to be retried")
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		if _, err := retryer.RetryDelay(attempt, throttled); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if retried := retriedCalls() - before; retried != 3 {
+		t.Errorf("expected 3 retries counted, got %d", retried)
+	}
+	if _, ok := retryer.(aws.RetryerV2); !ok {
+		t.Errorf("expected the retryer to keep GetAttemptToken")
+	}
+}
@@ -18,6 +18,12 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if isGithubActions() {
+			exitOnError(applyGithubInputs(cmd, os.Getenv))
+		}
+		exitOnError(validateOutputFlags())
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -25,7 +31,7 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(ExitInternal)
 	}
 }
 
@@ -35,6 +41,9 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sesame.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", OutputTable, fmt.Sprintf("Provide the output format, one of %v.", outputFormats))
+	rootCmd.PersistentFlags().Float64Var(&apiRate, "api-rate", DefaultApiRate, "Provide how many AWS calls per second the whole run may make, shared by every poller and scope. (0 is unlimited)")
+	rootCmd.PersistentFlags().StringVar(&formatFlag, "format", "", "Provide a Go template printed once per result, e.g. '{{.InstanceId}} {{.Tags.Nickname}}', instead of --output.")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
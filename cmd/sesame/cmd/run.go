@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/spf13/cobra"
+)
+
+var runDocument string
+var runDocumentVersion string
+var runTarget string
+var runNicknameTag string
+var runParameters []string
+var runTargetParameterName string
+var runMaxConcurrency string
+var runMaxErrors string
+
+// MaxTargetValues is as many instance ids as the one ParameterValues target of an execution may carry.
+const MaxTargetValues = 50
+
+// startListedAttempts is how many polls a started execution gets to show up in DescribeAutomationExecutions.
+const startListedAttempts = 5
+
+// automationRun is what sesame run starts: a document on the targets it resolved, with its parameters expanded.
+type automationRun struct {
+	document            string
+	version             string
+	parameters          map[string][]string
+	targets             []ssmsearch.Instance
+	targetParameterName string
+	maxConcurrency      string
+	maxErrors           string
+}
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Start an automation on the hosts you name and track it",
+	Long: `Start an automation execution with StartAutomationExecution and track it like trackomate does, in one go.
+
+--target is an instance id, an alias, a nickname (the --tag tag's value) or a target expression as search takes it,
+e.g. --target "Env=prod and ping=Online". Every host it matches is passed to the document's --target-parameter-name
+parameter, at most 50, with --max-concurrency and --max-errors as the rate control.
+
+-P key=value sets a parameter, repeat a key for a StringList. Values are Go templates of the targets, e.g.
+-P "Message=patching {{.Tags.Env}}" or -P "Host={{.Name}} ({{.InstanceId}})", a value has to come out the same for
+every target.
+
+Every trackomate flag, --timeout, --events, --junit or --on-timeout, applies to tracking the execution it started.`,
+	Args: ValidateArgsFunc(),
+	Run: func(cmd *cobra.Command, args []string) {
+		_, err := fmt.Fprintf(os.Stderr, "run called: [doc=%s] [version=%s] [target=%s]\n", runDocument, runDocumentVersion, runTarget)
+		if err != nil {
+			panic(err)
+		}
+		if len(runDocument) == 0 {
+			exitOnError(&SesameError{msg: "provide a --doc"})
+		}
+		parameters, err := parseRunParameters(runParameters)
+		exitOnError(err)
+
+		tracker := trackomateFromFlags(cmd, "")
+		tracker.conf()
+		ctx := context.Background()
+		run := automationRun{
+			document:            runDocument,
+			version:             runDocumentVersion,
+			targetParameterName: runTargetParameterName,
+			maxConcurrency:      runMaxConcurrency,
+			maxErrors:           runMaxErrors,
+		}
+		if len(runTarget) > 0 {
+			run.targets, err = resolveRunTargets(ctx, &tracker.SSMCommand, runTarget, runNicknameTag)
+			exitOnError(err)
+		}
+		run.parameters, err = expandParameters(parameters, run.targets)
+		exitOnError(err)
+		for _, target := range run.targets {
+			_, _ = fmt.Fprintf(progressOut(), " TARGET: %s[%s] %s\n", target.Name, target.InstanceId, target.PingStatus)
+		}
+
+		started, err := tracker.svc.StartAutomationExecution(ctx, run.input())
+		exitOnError(err)
+		tracker.automationExecutionId = aws.ToString(started.AutomationExecutionId)
+		_, _ = fmt.Fprintf(progressOut(), "Started %s: automation-id=[%s] on %d targets\n", runDocument, tracker.automationExecutionId, len(run.targets))
+		exitOnError(tracker.waitUntilListed(ctx))
+		tracker.thingDo()
+	},
+}
+
+// parseRunParameters reads -P key=value pairs, a key given again adds another value to it.
+func parseRunParameters(pairs []string) (map[string][]string, error) {
+	parameters := make(map[string][]string)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, &SesameError{msg: fmt.Sprintf("bad parameter [%s], expected key=value", pair)}
+		}
+		key := strings.TrimSpace(parts[0])
+		parameters[key] = append(parameters[key], parts[1])
+	}
+	return parameters, nil
+}
+
+// resolveRunTargets finds the hosts --target names: an instance id, an alias, a nickname or a target expression.
+func resolveRunTargets(ctx context.Context, ssmCommand *SSMCommand, target string, tagKey string) ([]ssmsearch.Instance, error) {
+	var instances []ssmsearch.Instance
+	var err error
+	if ssmsearch.IsInstanceId(target) {
+		instances, err = ssmCommand.searcher().DescribeInstances(ctx, []string{target})
+	} else {
+		var isAlias bool
+		instances, isAlias, err = ssmCommand.resolveAlias(ctx, target)
+		if err == nil && !isAlias {
+			if isTargetExpression(target) {
+				var expression *ssmsearch.Expression
+				expression, err = parseTarget(target)
+				if err != nil {
+					return nil, err
+				}
+				instances, err = ssmCommand.searcher().SearchByExpression(ctx, expression)
+			} else {
+				instances, err = ssmCommand.searcher().SearchByNickname(ctx, target, tagKey)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, &SesameError{msg: fmt.Sprintf("No hosts for target [%s].", target), code: ExitNotFound}
+	}
+	if len(instances) > MaxTargetValues {
+		return nil, &SesameError{msg: fmt.Sprintf("target [%s] matched %d hosts, an execution takes at most %d, narrow it down", target, len(instances), MaxTargetValues)}
+	}
+	return instances, nil
+}
+
+// isTargetExpression tells a target expression, or the older Key:Value, apart from a plain nickname.
+func isTargetExpression(target string) bool {
+	return strings.ContainsAny(target, "=():")
+}
+
+// expandParameters runs every parameter value through the template of each target, none for no targets.
+func expandParameters(parameters map[string][]string, targets []ssmsearch.Instance) (map[string][]string, error) {
+	contexts := []templateContext{{}}
+	if len(targets) > 0 {
+		contexts = nil
+		for _, target := range targets {
+			contexts = append(contexts, templateContext{Tags: target.Tags, InstanceId: target.InstanceId, Name: target.Name})
+		}
+	}
+	expanded := make(map[string][]string, len(parameters))
+	for key, values := range parameters {
+		for _, value := range values {
+			value, err := expandTemplate(key, value, contexts)
+			if err != nil {
+				return nil, err
+			}
+			expanded[key] = append(expanded[key], value)
+		}
+	}
+	return expanded, nil
+}
+
+// expandTemplate executes value for each context, it has to come out the same for all of them as an execution
+// takes one value for all its targets.
+func expandTemplate(name string, value string, contexts []templateContext) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(value)
+	if err != nil {
+		return "", &SesameError{msg: fmt.Sprintf("bad template in parameter [%s]: %v", name, err)}
+	}
+	expanded := ""
+	for i, context := range contexts {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, context); err != nil {
+			return "", &SesameError{msg: fmt.Sprintf("parameter [%s]: %v", name, err)}
+		}
+		if i > 0 && b.String() != expanded {
+			return "", &SesameError{msg: fmt.Sprintf("parameter [%s] is [%s] on %s but [%s] on %s, run each of them on its own", name, expanded, contexts[0].InstanceId, b.String(), context.InstanceId)}
+		}
+		expanded = b.String()
+	}
+	return expanded, nil
+}
+
+func (run automationRun) input() *ssm.StartAutomationExecutionInput {
+	input := &ssm.StartAutomationExecutionInput{
+		DocumentName: aws.String(run.document),
+		Parameters:   run.parameters,
+	}
+	if run.version != "" {
+		input.DocumentVersion = aws.String(run.version)
+	}
+	if len(run.targets) > 0 {
+		ids := make([]string, 0, len(run.targets))
+		for _, target := range run.targets {
+			ids = append(ids, target.InstanceId)
+		}
+		input.Targets = []types.Target{{Key: aws.String("ParameterValues"), Values: ids}}
+		input.TargetParameterName = aws.String(run.targetParameterName)
+		input.MaxConcurrency = aws.String(run.maxConcurrency)
+		input.MaxErrors = aws.String(run.maxErrors)
+	}
+	return input
+}
+
+// waitUntilListed gives an execution just started the moment it may take to show up in DescribeAutomationExecutions,
+// which tracking reads.
+func (trackomate *Trackomate) waitUntilListed(ctx context.Context) error {
+	poll := newBackoff(trackomate.pollMin, trackomate.pollMax)
+	for i := 0; i < startListedAttempts; i++ {
+		parents, err := describeAllExecutions(ctx, trackomate.svc, &ssm.DescribeAutomationExecutionsInput{
+			Filters:    trackomate.getParent(),
+			MaxResults: &trackomate.maxRecords,
+		})
+		if err != nil && !isTransientError(err) {
+			return err
+		}
+		if err == nil && len(parents) > 0 {
+			return nil
+		}
+		time.Sleep(poll.next())
+	}
+	return &SesameError{msg: fmt.Sprintf("automation-id=[%s] started but isn't listed yet, track it with trackomate -i %s", trackomate.automationExecutionId, trackomate.automationExecutionId), code: ExitNotFound}
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runDocument, "doc", "", "Provide the automation document name, or ARN, to start.")
+	runCmd.Flags().StringVar(&runDocumentVersion, "version", "", "Provide the document version. (default: the default version)")
+	runCmd.Flags().StringVar(&runTarget, "target", "", "Provide the hosts to run on, an instance id, alias, nickname or target expression, e.g. \"Env=prod and ping=Online\".")
+	runCmd.Flags().StringVarP(&runNicknameTag, "tag", "t", ssmsearch.DefaultNicknameTag, "Provide the tag key a --target nickname is the value of.")
+	runCmd.Flags().StringArrayVarP(&runParameters, "parameter", "P", nil, "Provide a document parameter as key=value, the value a template of the targets, e.g. \"Env={{.Tags.Env}}\". Repeat for more parameters, or more values of one.")
+	runCmd.Flags().StringVar(&runTargetParameterName, "target-parameter-name", "InstanceIds", "Provide the document parameter the --target hosts are passed in.")
+	runCmd.Flags().StringVar(&runMaxConcurrency, "max-concurrency", "1", "Provide how many targets, or what percentage of them, run at once.")
+	runCmd.Flags().StringVar(&runMaxErrors, "max-errors", "0", "Provide how many targets, or what percentage of them, may fail before the rest are not started.")
+	addTrackingFlags(runCmd)
+
+	err := runCmd.RegisterFlagCompletionFunc("doc", libraryCompletions)
+	if err != nil {
+		exitOnError(err)
+	}
+}
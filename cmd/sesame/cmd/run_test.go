@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestParseRunParameters(t *testing.T) {
+	parameters, err := parseRunParameters([]string{"Commands=uptime", "Commands=df -h", "Message=a=b", " Env =prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"Commands": {"uptime", "df -h"}, "Message": {"a=b"}, "Env": {"prod"}}
+	if !reflect.DeepEqual(parameters, expected) {
+		t.Errorf("expected %v, got %v", expected, parameters)
+	}
+	for _, bad := range []string{"Commands", "=uptime"} {
+		if _, err := parseRunParameters([]string{bad}); err == nil {
+			t.Errorf("[%s]: expected an error", bad)
+		}
+	}
+}
+
+func TestExpandParameters(t *testing.T) {
+	web1 := ssmsearch.Instance{InstanceId: "i-1", Name: "web-1", Tags: map[string]string{"Env": "prod", "Nickname": "web-1"}}
+	web2 := ssmsearch.Instance{InstanceId: "i-2", Name: "web-2", Tags: map[string]string{"Env": "prod", "Nickname": "web-2"}}
+	cases := []struct {
+		name       string
+		parameters map[string][]string
+		targets    []ssmsearch.Instance
+		expected   map[string][]string
+		isError    bool
+	}{
+		{"plain", map[string][]string{"Commands": {"uptime"}}, []ssmsearch.Instance{web1, web2}, map[string][]string{"Commands": {"uptime"}}, false},
+		{"same on every target", map[string][]string{"Message": {"patching {{.Tags.Env}}"}}, []ssmsearch.Instance{web1, web2}, map[string][]string{"Message": {"patching prod"}}, false},
+		{"one target", map[string][]string{"Host": {"{{.Name}} ({{.InstanceId}})"}}, []ssmsearch.Instance{web1}, map[string][]string{"Host": {"web-1 (i-1)"}}, false},
+		{"missing tag", map[string][]string{"Team": {"[{{.Tags.Team}}]"}}, []ssmsearch.Instance{web1}, map[string][]string{"Team": {"[]"}}, false},
+		{"no targets", map[string][]string{"Team": {"[{{.Tags.Team}}]"}}, nil, map[string][]string{"Team": {"[]"}}, false},
+		{"differs between targets", map[string][]string{"Host": {"{{.Name}}"}}, []ssmsearch.Instance{web1, web2}, nil, true},
+		{"bad template", map[string][]string{"Host": {"{{.Name"}}, []ssmsearch.Instance{web1}, nil, true},
+	}
+	for _, c := range cases {
+		expanded, err := expandParameters(c.parameters, c.targets)
+		if c.isError {
+			if err == nil {
+				t.Errorf("[%s]: expected an error, got %v", c.name, expanded)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(expanded, c.expected) {
+			t.Errorf("[%s]: expected %v, got %v %v", c.name, c.expected, expanded, err)
+		}
+	}
+}
+
+func TestAutomationRunInput(t *testing.T) {
+	run := automationRun{
+		document:            "Patch",
+		parameters:          map[string][]string{"Operation": {"Install"}},
+		targets:             []ssmsearch.Instance{{InstanceId: "i-1"}, {InstanceId: "mi-2"}},
+		targetParameterName: "InstanceIds",
+		maxConcurrency:      "10%",
+		maxErrors:           "1",
+	}
+	input := run.input()
+	if input.DocumentVersion != nil {
+		t.Errorf("expected the default version, got %s", aws.ToString(input.DocumentVersion))
+	}
+	if len(input.Targets) != 1 || aws.ToString(input.Targets[0].Key) != "ParameterValues" || !reflect.DeepEqual(input.Targets[0].Values, []string{"i-1", "mi-2"}) {
+		t.Errorf("expected the instance ids as parameter values, got %+v", input.Targets)
+	}
+	if aws.ToString(input.TargetParameterName) != "InstanceIds" || aws.ToString(input.MaxConcurrency) != "10%" || aws.ToString(input.MaxErrors) != "1" {
+		t.Errorf("unexpected rate control %s %s %s", aws.ToString(input.TargetParameterName), aws.ToString(input.MaxConcurrency), aws.ToString(input.MaxErrors))
+	}
+
+	run.version, run.targets = "3", nil
+	input = run.input()
+	if aws.ToString(input.DocumentVersion) != "3" || input.Targets != nil || input.MaxConcurrency != nil {
+		t.Errorf("expected version 3 without targets or rate control, got %+v", input)
+	}
+}
+
+func TestIsTargetExpression(t *testing.T) {
+	for target, expected := range map[string]bool{
+		"DrStrange":                     false,
+		"web-1":                         false,
+		"Env=prod":                      true,
+		"Team:FunTeam":                  true,
+		"not (Env=prod or Env=staging)": true,
+	} {
+		if isTargetExpression(target) != expected {
+			t.Errorf("[%s]: expected %v", target, expected)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"os"
+	"sync"
+)
+
+const DefaultScopeWorkers = 4
+
+var awsProfiles []string
+var awsRegions []string
+var scopeWorkers int
+
+// Scope is one AWS profile and region pair a command fans out over, empty means the default config.
+type Scope struct {
+	Profile string
+	Region  string
+}
+
+func (scope Scope) String() string {
+	profile, region := scope.Profile, scope.Region
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = DefaultProfile
+		}
+	}
+	if region == "" {
+		region = "default"
+	}
+	return fmt.Sprintf("%s/%s", profile, region)
+}
+
+// ScopedInstances is what one scope's search returned, Err is that scope's failure alone.
+type ScopedInstances struct {
+	Scope     Scope
+	Account   string
+	Region    string
+	Instances []ssmsearch.Instance
+	Err       error
+}
+
+// environ is the current environment pointed at the scope, for the aws cli and helper scripts we exec.
+func (scope Scope) environ() []string {
+	env := os.Environ()
+	if scope.Profile != "" {
+		env = append(env, "AWS_PROFILE="+scope.Profile)
+	}
+	if scope.Region != "" {
+		env = append(env, "AWS_REGION="+scope.Region, "AWS_DEFAULT_REGION="+scope.Region)
+	}
+	return env
+}
+
+func addScopeFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&awsProfiles, "profiles", nil, "Provide AWS profiles to search concurrently. (default: the current profile)")
+	cmd.Flags().StringSliceVar(&awsRegions, "regions", nil, "Provide AWS regions to search concurrently, in every profile. (default: the profile's region)")
+	cmd.Flags().IntVar(&scopeWorkers, "workers", DefaultScopeWorkers, "Provide how many profile/region pairs to search at once.")
+}
+
+// selectedScopes is every --profiles and --regions pair.
+func selectedScopes() []Scope {
+	profiles, regions := awsProfiles, awsRegions
+	if len(profiles) == 0 {
+		profiles = []string{""}
+	}
+	if len(regions) == 0 {
+		regions = []string{""}
+	}
+	var scopes []Scope
+	for _, p := range profiles {
+		for _, r := range regions {
+			scopes = append(scopes, Scope{Profile: p, Region: r})
+		}
+	}
+	return scopes
+}
+
+// forEachScope runs search in every scope, at most scopeWorkers at a time. Results keep the order of scopes, each
+// scope's account is looked up only when there is more than one to tell apart.
+func forEachScope(scopes []Scope, search func(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error)) []ScopedInstances {
+	results := make([]ScopedInstances, len(scopes))
+	workers := scopeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = searchScope(scopes[i], len(scopes) > 1, search)
+			}
+		}()
+	}
+	for i := range scopes {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+func searchScope(scope Scope, isAccountShown bool, search func(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error)) ScopedInstances {
+	ctx := context.Background()
+	result := ScopedInstances{Scope: scope}
+	ssmCommand := &SSMCommand{}
+	if result.Err = ssmCommand.load(scope); result.Err != nil {
+		return result
+	}
+	result.Region = ssmCommand.region
+	if isAccountShown {
+		identity, err := sts.NewFromConfig(ssmCommand.awsConfig).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Account = aws.ToString(identity.Account)
+	}
+	result.Instances, result.Err = search(ctx, ssmCommand)
+	return result
+}
+
+// reportScopeErrors writes each failed scope to stderr and tells if there were any.
+func reportScopeErrors(results []ScopedInstances) bool {
+	failed := false
+	for _, r := range results {
+		if r.Err != nil {
+			failed = true
+			_, _ = fmt.Fprintf(os.Stderr, "[%s]: %v\n", r.Scope, r.Err)
+		}
+	}
+	return failed
+}
+
+// allScopesFailed is the first scope's error when not one scope succeeded, nil otherwise.
+func allScopesFailed(results []ScopedInstances) error {
+	for _, r := range results {
+		if r.Err == nil {
+			return nil
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return results[0].Err
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestAllScopesFailed(t *testing.T) {
+	denied := &smithy.GenericAPIError{Code: "AccessDeniedException"}
+	cases := []struct {
+		name     string
+		results  []ScopedInstances
+		expected int
+	}{
+		{"one scope denied", []ScopedInstances{{Err: denied}}, ExitAuth},
+		{"every scope failed", []ScopedInstances{{Scope: Scope{Profile: "a"}, Err: errors.New("boom")}, {Scope: Scope{Profile: "b"}, Err: denied}}, ExitInternal},
+		{"some succeeded", []ScopedInstances{{Err: denied}, {}}, ExitSuccess},
+		{"none failed", []ScopedInstances{{}}, ExitSuccess},
+	}
+	for _, c := range cases {
+		code := ExitSuccess
+		if err := allScopesFailed(c.results); err != nil {
+			code = exitCodeOf(err)
+		}
+		if code != c.expected {
+			t.Errorf("[%s]: expected %d, got %d", c.name, c.expected, code)
+		}
+	}
+}
@@ -3,74 +3,311 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 var nickname string
 var tag string
+var isSingleResult bool
+var searchShowTags []string
+var searchTarget string
+var searchInventory []string
+var searchTags []string
+var isIndexSearch bool
+var isIndexRefresh bool
+var indexMaxAge time.Duration
+
+const maxSuggestions = 5
 
 type Search struct {
 	SSMCommand
+	target    *ssmsearch.Expression
+	inventory []types.InventoryFilter
+}
+
+// SearchResult is one host matched by a search, as rendered by every output format.
+type SearchResult struct {
+	ssmsearch.Instance
+	Account string
+	Region  string
+	// Score is only set by index searches, 1 is an exact match.
+	Score float64 `json:",omitempty"`
 }
 
 // searchCmd represents the search command
 var searchCmd = &cobra.Command{
 	Use:   "search",
-	Short: "search for a single host from a nickname you provide",
+	Short: "search for hosts from a nickname you provide",
 	Long: `If you have a "Nickname" tag on your host search using that.
 
-If you don't have the default tag name then you can provide it.`,
+If you don't have the default tag name then you can provide it.
+
+A nickname registered with "sesame alias add" is used before any tag.
+
+With --index, or a pattern nickname, the tagged fleet is downloaded once into a local index and searched there:
+  strange    case-insensitive substring
+  Dr*        glob
+  strange~   fuzzy, ranked by score
+
+A --target expression narrows the search, or replaces the nickname, e.g. --target "Env=prod and ping=Online".
+Besides tags it can compare the host attributes id, ping, platform, platformName, platformVersion, resource,
+agent, association, ip and computer, e.g. --target "ip=10.0.4.12" or --target "agent!=3.2.582.0".
+
+--inventory queries SSM Inventory, e.g. --inventory AWS:Application.Name=nginx, all queries must match.
+
+--profiles and --regions search every pair of them concurrently, a failing pair is reported without hiding the others.
+
+Every matching host is printed, use --single to require exactly one match and print only its instance id.`,
 	Args: ValidateArgsFunc(),
 	Run: func(cmd *cobra.Command, args []string) {
-		_, err := fmt.Fprintf(os.Stderr, "search called: [%s: %s]\n", tag, nickname)
+		_, err := fmt.Fprintf(os.Stderr, "search called: [%s: %s] [target: %s]\n", tag, nickname, searchTarget)
 		if err != nil {
 			panic(err)
 		}
-		if len(nickname) == 0 {
-			exitOnError(fmt.Errorf("tag cannot be empty %s:%s", tag, nickname))
+		if len(nickname) == 0 && len(searchTarget) == 0 && len(searchInventory) == 0 {
+			exitOnError(&SesameError{msg: "provide a --nickname, a --target, an --inventory query or a mix of them"})
+		}
+		var target *ssmsearch.Expression
+		if len(searchTarget) > 0 {
+			target, err = parseTarget(searchTarget)
+			exitOnError(err)
 		}
 
-		s := Search{SSMCommand{}}
-		s.conf()
+		var inventory []types.InventoryFilter
+		for _, query := range searchInventory {
+			filter, err := ssmsearch.ParseInventoryFilter(query)
+			exitOnError(err)
+			inventory = append(inventory, filter)
+		}
+
+		s := Search{SSMCommand{}, target, inventory}
 		s.thingDo()
 	},
 }
 
 func (search *Search) thingDo() {
-	// Create our filter slice
-	filters := []types.InstanceInformationStringFilter{
-		{
-			Key:    aws.String(fmt.Sprintf("tag:%s", tag)),
-			Values: []string{nickname},
-		},
-	}
-
-	const ApiMin = 5
-	maxRes := int32(ApiMin)
-	input := &ssm.DescribeInstanceInformationInput{
-		Filters:    filters,
-		MaxResults: &maxRes,
-	}
-	res, serviceError := search.svc.DescribeInstanceInformation(context.Background(), input)
-	exitOnError(serviceError)
-	if len(res.InstanceInformationList) > 1 {
-		exitOnError(&SesameError{msg: "Too many results for tag."})
-
-	} else if len(res.InstanceInformationList) == 0 {
-		exitOnError(&SesameError{msg: "No results for tag."})
+	isIndex := isIndexSearch || len(searchTags) > 0 || isPatternSearch(nickname)
+	if isIndex && len(nickname) == 0 {
+		exitOnError(&SesameError{msg: "index search needs a nickname to match"})
+	}
+	scopes := selectedScopes()
+	var scoped []ScopedInstances
+	if isIndex {
+		scoped = forEachScope(scopes, search.indexedFleet)
 	} else {
-		for _, item := range res.InstanceInformationList {
+		scoped = forEachScope(scopes, search.find)
+	}
+	isPartial := reportScopeErrors(scoped)
+	if err := allScopesFailed(scoped); err != nil {
+		os.Exit(exitCodeOf(err))
+	}
 
-			_, err := fmt.Fprintln(os.Stdout, *item.InstanceId)
-			if err != nil {
-				panic(err)
+	var results []SearchResult
+	for _, s := range scoped {
+		for _, instance := range s.Instances {
+			results = append(results, SearchResult{Instance: instance, Account: s.Account, Region: s.Region})
+		}
+	}
+	if isIndex {
+		results = search.match(results)
+	}
+	if len(results) == 0 {
+		exitOnError(&SesameError{msg: "No results for tag.", code: ExitNotFound})
+	}
+	if isSingleResult {
+		if len(results) > 1 {
+			exitOnError(&SesameError{msg: "Too many results for tag."})
+		}
+		if !isMachineOutput() {
+			_, err := fmt.Fprintln(os.Stdout, results[0].InstanceId)
+			exitOnError(err)
+			return
+		}
+	}
+	exitOnError(search.write(results, len(scopes) > 1))
+	if isPartial {
+		os.Exit(ExitPartial)
+	}
+}
+
+func (search *Search) find(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error) {
+	if len(search.inventory) == 0 {
+		return search.findByName(ctx, ssmCommand)
+	}
+	ids, err := ssmCommand.searcher().SearchByInventory(ctx, search.inventory)
+	if err != nil {
+		return nil, err
+	}
+	if len(nickname) == 0 && search.target == nil {
+		return ssmCommand.searcher().DescribeInstances(ctx, ids)
+	}
+	instances, err := search.findByName(ctx, ssmCommand)
+	if err != nil {
+		return nil, err
+	}
+	return onlyInstanceIds(instances, ids), nil
+}
+
+func onlyInstanceIds(instances []ssmsearch.Instance, ids []string) []ssmsearch.Instance {
+	isWanted := make(map[string]bool)
+	for _, id := range ids {
+		isWanted[id] = true
+	}
+	var wanted []ssmsearch.Instance
+	for _, instance := range instances {
+		if isWanted[instance.InstanceId] {
+			wanted = append(wanted, instance)
+		}
+	}
+	return wanted
+}
+
+func (search *Search) findByName(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error) {
+	if len(nickname) > 0 {
+		aliased, isAlias, err := ssmCommand.resolveAlias(ctx, nickname)
+		if err != nil {
+			return nil, err
+		}
+		if isAlias {
+			if search.target == nil {
+				return aliased, nil
+			}
+			var matched []ssmsearch.Instance
+			for _, instance := range aliased {
+				if search.target.Match(instance) {
+					matched = append(matched, instance)
+				}
 			}
+			return matched, nil
 		}
 	}
+	if search.target == nil {
+		return ssmCommand.searcher().SearchByNickname(ctx, nickname, tag)
+	} else if len(nickname) == 0 {
+		return ssmCommand.searcher().SearchByExpression(ctx, search.target)
+	}
+	return ssmCommand.searcher().SearchByExpression(ctx, ssmsearch.And(ssmsearch.TagEquals(tag, nickname), search.target))
+}
+
+func (search *Search) indexedFleet(ctx context.Context, ssmCommand *SSMCommand) ([]ssmsearch.Instance, error) {
+	index, err := ssmCommand.loadIndex(ctx, indexMaxAge, isIndexRefresh)
+	if err != nil {
+		return nil, err
+	}
+	if len(search.inventory) == 0 {
+		return index.Instances, nil
+	}
+	ids, err := ssmCommand.searcher().SearchByInventory(ctx, search.inventory)
+	if err != nil {
+		return nil, err
+	}
+	return onlyInstanceIds(index.Instances, ids), nil
+}
+
+// match scores the nickname against every --searchTags key of the indexed fleet, best score first.
+func (search *Search) match(fleet []SearchResult) []SearchResult {
+	keys := search.searchKeys()
+	matcher := newNicknameMatcher(nickname)
+	var results []SearchResult
+	for _, instance := range fleet {
+		best := 0.0
+		for _, k := range keys {
+			if v, ok := instance.Tags[k]; ok {
+				if s := matcher.score(v); s > best {
+					best = s
+				}
+			}
+		}
+		if best > 0 && (search.target == nil || search.target.Match(instance.Instance)) {
+			instance.Score = best
+			results = append(results, instance)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].InstanceId < results[j].InstanceId
+		}
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) == 0 || (len(results) > 1 && results[0].Score == results[1].Score) {
+		var values []string
+		for _, instance := range fleet {
+			for _, k := range keys {
+				if v, ok := instance.Tags[k]; ok {
+					values = append(values, v)
+				}
+			}
+		}
+		if suggestions := suggest(nickname, values, maxSuggestions); len(suggestions) > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "did you mean: %s\n", strings.Join(suggestions, ", "))
+		}
+	}
+	return results
+}
+
+func (search *Search) searchKeys() []string {
+	if len(searchTags) > 0 {
+		return searchTags
+	}
+	return []string{tag}
+}
+
+func (search *Search) write(results []SearchResult, isScoped bool) error {
+	items := make([]interface{}, len(results))
+	for i := range results {
+		items[i] = results[i]
+	}
+	return writeOutput(os.Stdout, items, func(w io.Writer) error {
+		showTags := searchShowTags
+		if len(showTags) == 0 {
+			showTags = search.searchKeys()
+		}
+		tw := newTableWriter(w)
+		header := []string{"INSTANCE ID", "PING STATUS", "PLATFORM", "RESOURCE TYPE"}
+		if isScoped {
+			header = append(header, "ACCOUNT", "REGION")
+		}
+		for _, t := range showTags {
+			header = append(header, strings.ToUpper(t))
+		}
+		isScored := len(results) > 0 && results[0].Score > 0
+		if isScored {
+			header = append(header, "SCORE")
+		}
+		_, err := fmt.Fprintln(tw, strings.Join(header, "\t"))
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			platform := r.PlatformType
+			if r.PlatformName != "" {
+				platform = fmt.Sprintf("%s (%s)", r.PlatformType, r.PlatformName)
+			}
+			row := []string{r.InstanceId, r.PingStatus, platform, r.ResourceType}
+			if isScoped {
+				row = append(row, r.Account, r.Region)
+			}
+			for _, t := range showTags {
+				row = append(row, r.Tags[t])
+			}
+			if isScored {
+				row = append(row, fmt.Sprintf("%.2f", r.Score))
+			}
+			_, err := fmt.Fprintln(tw, strings.Join(row, "\t"))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	})
 }
 
 func init() {
@@ -86,10 +323,17 @@ func init() {
 	// is called directly, e.g.:
 	searchCmd.Flags().StringVarP(&nickname, "nickname", "n", "", "Provide the value (or name) to search SSM hosts by tag value. See additional flag for your custom tag key.")
 	searchCmd.Flags().StringVarP(&tag, "tag", "t", "Nickname", "Provide the value of a tag name to search SSM hosts by tag value.")
-
-	err := searchCmd.MarkFlagRequired("nickname")
+	searchCmd.Flags().StringVar(&searchTarget, "target", "", "Provide a target expression, e.g. \"Env=prod and Team in (a,b) and not DeployLocked=true\", all hosts must match.")
+	searchCmd.Flags().StringArrayVar(&searchInventory, "inventory", nil, "Provide an SSM Inventory query, e.g. AWS:Application.Name=nginx (also !=, ^=, <, >), may be repeated.")
+	searchCmd.Flags().BoolVarP(&isSingleResult, "single", "s", false, "Fail unless exactly one host matches and print only its instance id (the pre-table behavior).")
+	searchCmd.Flags().StringSliceVar(&searchShowTags, "showTags", nil, "Provide tag keys to show as table columns. (default: the searched tag keys)")
+	searchCmd.Flags().StringSliceVar(&searchTags, "searchTags", nil, "Provide several tag keys to match the nickname against, implies --index. (default: the --tag key)")
+	searchCmd.Flags().BoolVar(&isIndexSearch, "index", false, "Search a local index of the tagged fleet with substring, glob (*) or fuzzy (trailing ~) matching.")
+	searchCmd.Flags().BoolVar(&isIndexRefresh, "refreshIndex", false, "Rebuild the local index before searching it.")
+	addScopeFlags(searchCmd)
+	err := searchCmd.RegisterFlagCompletionFunc("nickname", nicknameCompletions)
 	if err != nil {
-		return
+		exitOnError(err)
 	}
-
+	searchCmd.Flags().DurationVar(&indexMaxAge, "indexMaxAge", DefaultIndexMaxAge, "Provide how old the local index may be before it is rebuilt.")
 }
@@ -4,13 +4,15 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	ec2 "github.com/aws/aws-sdk-go-v2/service/ec2"
-	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"io"
 	"math"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/madflojo/tasks"
@@ -21,67 +23,245 @@ import (
 var automationExecutionId string
 var maxPollCount int
 var isExitCodeTiedToAutomationStatus bool
+var trackomateEvents string
+var commandId string
+var trackomateTimeout time.Duration
+var onTimeout string
+var pollMin time.Duration
+var pollMax time.Duration
+var junitPath string
 
 const DefaultPendingPollCount = 40
 const ApiMax = 50
 const maxRecords = int32(ApiMax)
 
+// maxFilterValues is as many values as one AutomationExecutionFilter takes.
+const maxFilterValues = 10
+
+// ActionExecuteAutomation is the step action that starts an automation as a child of the one running it.
+const ActionExecuteAutomation = "aws:executeAutomation"
+
 type Trackomate struct {
 	SSMCommand
 	maxRecords            int32
 	reportChan            *chan string
 	scheduler             *tasks.Scheduler
-	parentSchedulerId     string
-	childrenSchedulerId   string
 	automationExecutionId string
 	maxPollCount          int
 	summaryStatusCode     int
+	parent                ExecutionRecord
+	children              []ExecutionRecord
+	events                *eventStream
+	commandId             string
+	timeout               time.Duration
+	onTimeout             string
+	pollMin               time.Duration
+	pollMax               time.Duration
+	isTimedOut            bool
+	skippedPolls          int64
+	cancelOnExit          string
+	isStopping            bool
+	approvals             *approvalDesk
+	cache                 *runCache
+	progress              *progressPrinter
+	polling               *pollState
+	// mu guards parent, children and summaryStatusCode, the parent and children polls write them from their own
+	// goroutines.
+	mu sync.Mutex
+}
+
+// ExecutionRecord is an automation execution as trackomate --output and --format print it,
+// the parent execution comes first and is followed by its children.
+type ExecutionRecord struct {
+	AutomationExecutionId string `json:",omitempty"`
+	// CommandId is set instead when a Run Command is tracked, the parent is the command and each child its invocation on a target.
+	CommandId         string `json:",omitempty"`
+	ParentExecutionId string `json:",omitempty"`
+	DocumentName      string
+	DocumentVersion   string `json:",omitempty"`
+	// Status is the AutomationExecutionStatus, e.g. InProgress, Success or Failed, or the command's StatusDetails.
+	Status string
+	// Target is the instance id a child execution ran against, TargetName its Name tag or alias.
+	Target             string              `json:",omitempty"`
+	TargetName         string              `json:",omitempty"`
+	FailureMessage     string              `json:",omitempty"`
+	ExecutionStartTime *time.Time          `json:",omitempty"`
+	ExecutionEndTime   *time.Time          `json:",omitempty"`
+	Outputs            map[string][]string `json:",omitempty"`
+	Steps              []StepRecord        `json:",omitempty"`
+	// Children are the executions this one started with aws:executeAutomation, at any depth.
+	Children []ExecutionRecord `json:",omitempty"`
+	// Commands are the plugin outputs of a Run Command invocation.
+	Commands []CommandRecord `json:",omitempty"`
+}
+
+// key identifies the record from one poll to the next.
+func (record ExecutionRecord) key() string {
+	if record.AutomationExecutionId != "" {
+		return record.AutomationExecutionId
+	}
+	return record.CommandId + "/" + record.Target
+}
+
+// isCompleted sorts the record's status as an automation, or a Run Command, status.
+func (record ExecutionRecord) isCompleted() (bool, bool) {
+	if record.AutomationExecutionId == "" && record.CommandId != "" {
+		return isCompletedCommandStatus(record.Status)
+	}
+	return isCompletedAutomationStatus(types.AutomationExecutionStatus(record.Status))
+}
+
+// StepRecord is one step of an automation execution.
+type StepRecord struct {
+	StepName           string
+	StepExecutionId    string
+	Action             string `json:",omitempty"`
+	Status             string
+	FailureMessage     string                `json:",omitempty"`
+	FailureDetails     *types.FailureDetails `json:",omitempty"`
+	Inputs             map[string]string     `json:",omitempty"`
+	ExecutionStartTime *time.Time            `json:",omitempty"`
+	ExecutionEndTime   *time.Time            `json:",omitempty"`
+	Outputs            map[string][]string   `json:",omitempty"`
+	Commands           []CommandRecord       `json:",omitempty"`
+}
+
+// CommandRecord is the output of one plugin of a command a step sent to an instance.
+type CommandRecord struct {
+	CommandId  string
+	InstanceId string
+	PluginName string
+	Status     string
+	Output     string
+	// Stderr and OutputSource are only set once a truncated Output was replaced by the full one from S3 or CloudWatch Logs.
+	Stderr       string `json:",omitempty"`
+	OutputSource string `json:",omitempty"`
+}
+
+func (command CommandRecord) key() string {
+	return command.CommandId + "/" + command.InstanceId + "/" + command.PluginName
+}
+
+func newTrackomate(automationExecutionId string, maxPollCount int) *Trackomate {
+	reportChan := make(chan string, 10)
+	return &Trackomate{SSMCommand{}, maxRecords, &reportChan, tasks.New(), automationExecutionId, maxPollCount, 0, ExecutionRecord{}, nil, nil, "", 0, OnTimeoutFail, DefaultPollMin, DefaultPollMax, false, 0, CancelOnExitAsk, false, newApprovalDesk(), newRunCache(), newProgressPrinter(false), newPollState(), sync.Mutex{}}
+}
+
+// setParent keeps the parent as a poll just read it.
+func (trackomate *Trackomate) setParent(parent ExecutionRecord) {
+	trackomate.mu.Lock()
+	defer trackomate.mu.Unlock()
+	trackomate.parent = parent
+}
+
+// setChildren keeps the children as a poll just read them.
+func (trackomate *Trackomate) setChildren(children []ExecutionRecord) {
+	trackomate.mu.Lock()
+	defer trackomate.mu.Unlock()
+	trackomate.children = children
+}
+
+// records is the parent and children as the polls last read them.
+func (trackomate *Trackomate) records() (ExecutionRecord, []ExecutionRecord) {
+	trackomate.mu.Lock()
+	defer trackomate.mu.Unlock()
+	return trackomate.parent, trackomate.children
+}
+
+func newExecutionRecord(item types.AutomationExecutionMetadata) ExecutionRecord {
+	return ExecutionRecord{
+		AutomationExecutionId: aws.ToString(item.AutomationExecutionId),
+		ParentExecutionId:     aws.ToString(item.ParentAutomationExecutionId),
+		DocumentName:          aws.ToString(item.DocumentName),
+		DocumentVersion:       aws.ToString(item.DocumentVersion),
+		Status:                string(item.AutomationExecutionStatus),
+		Target:                aws.ToString(item.Target),
+		FailureMessage:        aws.ToString(item.FailureMessage),
+		ExecutionStartTime:    item.ExecutionStartTime,
+		ExecutionEndTime:      item.ExecutionEndTime,
+		Outputs:               item.Outputs,
+	}
 }
 
 // trackomateCmd represents the trackomate command
 var trackomateCmd = &cobra.Command{
 	Use:   "trackomate",
-	Short: "Track a start-automation-execution ",
-	Long:  `Track for limited amount of time progress on all hosts`,
-	Args:  ValidateArgsFunc(),
+	Short: "Track a start-automation-execution or a send-command",
+	Long: `Track for limited amount of time progress on all hosts.
+
+--id tracks an automation execution and every execution it started, --command-id tracks a Run Command
+(aws ssm send-command) and its invocation on every target.`,
+	Args: ValidateArgsFunc(),
 	Run: func(cmd *cobra.Command, args []string) {
-		_, err := fmt.Fprintf(os.Stderr, "trackomate called: [id=%s]\n", automationExecutionId)
+		_, err := fmt.Fprintf(os.Stderr, "trackomate called: [id=%s] [command-id=%s]\n", automationExecutionId, commandId)
 		if err != nil {
 			panic(err)
 		}
-		if len(automationExecutionId) == 0 {
-			exitOnError(&SesameError{msg: "id cannot be empty "})
+		if len(automationExecutionId) == 0 && len(commandId) == 0 {
+			exitOnError(&SesameError{msg: "provide an --id or a --command-id"})
+		}
+		if len(automationExecutionId) > 0 && len(commandId) > 0 {
+			exitOnError(&SesameError{msg: "provide an --id or a --command-id, not both"})
 		}
 
-		reportChan := make(chan string, 10)
-		tracker := Trackomate{SSMCommand{}, maxRecords, &reportChan, tasks.New(), "", "", automationExecutionId, maxPollCount, 0}
+		tracker := trackomateFromFlags(cmd, automationExecutionId)
+		tracker.commandId = commandId
 		tracker.conf()
 		tracker.thingDo()
 	},
 }
 
-func (trackomate *Trackomate) scheduleParent() string {
-	// Add a task
-	parentCheckId, err := trackomate.scheduler.Add(&tasks.Task{
-		Interval: 2 * time.Second,
-		TaskFunc: func() error {
-			endState := trackomate.checkParent()
-			if endState.IsEndState {
-				if endState.IsEndStateSuccess {
-					*trackomate.reportChan <- "Succeeded"
-					_, err := fmt.Fprintf(os.Stdout, "[%s]: Success!\n", trackomate.automationExecutionId)
-					exitOnError(err)
-				} else {
-					*trackomate.reportChan <- "Failed"
-					_, err := fmt.Fprintf(os.Stdout, "[%s]: Faled!\n", trackomate.automationExecutionId)
-					exitOnError(err)
-				}
+// trackomateFromFlags sets up a Trackomate from the tracking flags of cmd, trackomate's or run's, checking all of
+// them before anything is tracked, or started.
+func trackomateFromFlags(cmd *cobra.Command, automationExecutionId string) *Trackomate {
+	exitOnError(validatePolling(pollMin, pollMax, onTimeout))
+	exitOnError(validateCancelOnExit(cancelOnExit))
+	rules, err := parseApprovalRules(autoApproveIf)
+	exitOnError(err)
+	if trackomateTimeout > 0 && !cmd.Flags().Changed("maxPollCount") {
+		// the wall clock decides when to give up, not how many reports came in
+		maxPollCount = -1
+	}
+
+	tracker := newTrackomate(automationExecutionId, maxPollCount)
+	tracker.timeout = trackomateTimeout
+	tracker.onTimeout = onTimeout
+	tracker.pollMin = pollMin
+	tracker.pollMax = pollMax
+	tracker.cancelOnExit = cancelOnExit
+	tracker.approvals.rules = rules
+	tracker.progress.verbose = isVerbose
+	if trackomateEvents != "" {
+		if trackomateEvents != EventsNdjson {
+			exitOnError(&SesameError{msg: fmt.Sprintf("unknown events format [%s], expected %s", trackomateEvents, EventsNdjson)})
+		}
+		if isMachineOutput() {
+			exitOnError(&SesameError{msg: "--events and --output/--format both write to stdout, provide only one"})
+		}
+		tracker.events = newEventStream(os.Stdout)
+	}
+	if !isVerbose && isTerminal(progressOut()) {
+		liveOut = newLiveBlock(progressOut())
+	}
+	return tracker
+}
+
+func (trackomate *Trackomate) scheduleParent() {
+	trackomate.schedulePoll(newBackoff(trackomate.pollMin, trackomate.pollMax), func() bool {
+		endState := trackomate.checkParent()
+		if endState.IsEndState {
+			if endState.IsEndStateSuccess {
+				*trackomate.reportChan <- "Succeeded"
+				_, err := fmt.Fprintf(progressOut(), "[%s]: Success!\n", trackomate.automationExecutionId)
+				exitOnError(err)
+			} else {
+				*trackomate.reportChan <- "Failed"
+				_, err := fmt.Fprintf(progressOut(), "[%s]: Faled!\n", trackomate.automationExecutionId)
+				exitOnError(err)
 			}
-			return nil
-		},
+		}
+		return endState.IsEndState
 	})
-	exitOnError(err)
-	return parentCheckId
 }
 
 type ComplexStatus struct {
@@ -97,27 +277,28 @@ func (trackomate *Trackomate) checkParent() ComplexStatus {
 		Filters:    filters,
 		MaxResults: &trackomate.maxRecords,
 	}
-	res, serviceError := trackomate.svc.DescribeAutomationExecutions(context.Background(), &input)
-	exitOnError(serviceError)
+	parents, serviceError := describeAllExecutions(context.Background(), trackomate.svc, &input)
+	if serviceError != nil {
+		trackomate.skipPoll(serviceError)
+		return ComplexStatus{IsEndState: false}
+	}
 	cState := ComplexStatus{IsEndState: true, IsEndStateSuccess: false}
-	if len(res.AutomationExecutionMetadataList) == 0 {
-		exitOnError(&SesameError{msg: "No results for execution id."})
+	if len(parents) == 0 {
+		exitOnError(&SesameError{msg: "No results for execution id.", code: ExitNotFound})
 	} else {
-		for _, item := range res.AutomationExecutionMetadataList {
+		for _, item := range parents {
 
-			_, err := fmt.Fprintf(os.Stdout, "Parent document: %s [%s]\n", item.AutomationExecutionStatus, *item.DocumentName)
-			if err != nil {
-				exitOnError(err)
-			}
+			parent := newExecutionRecord(item)
+			trackomate.setParent(parent)
+			trackomate.progress.printf(parent.key(), parent.Status, "Parent document: %s [%s]\n", item.AutomationExecutionStatus, *item.DocumentName)
+			trackomate.events.parent(parent)
+			trackomate.handleParentApprovals(item)
 
 			isCompleted, isSuccess := trackomate.isCompletedStatus(item)
 
 			cState := ComplexStatus{IsEndState: isCompleted, IsEndStateSuccess: isSuccess}
 
 			if isCompleted {
-				if trackomate.parentSchedulerId != "" {
-					trackomate.scheduler.Del(trackomate.parentSchedulerId)
-				}
 				cState.IsEndState = true
 				cState.IsEndStateSuccess = isSuccess
 			} else if trackomate.isPendingStatus(item) {
@@ -127,7 +308,9 @@ func (trackomate *Trackomate) checkParent() ComplexStatus {
 				// this should only happen if AWS adds a status we didn't account for, or we have a bug!
 				cState.IsEndState = true
 				cState.IsEndStateSuccess = false
-				trackomate.summaryStatusCode = 1
+				trackomate.mu.Lock()
+				trackomate.summaryStatusCode = ExitInternal
+				trackomate.mu.Unlock()
 			}
 			return cState
 		}
@@ -183,9 +366,13 @@ func (trackomate *Trackomate) checkParent() ComplexStatus {
 //
 
 func (trackomate *Trackomate) isCompletedStatus(item types.AutomationExecutionMetadata) (bool, bool) {
+	return isCompletedAutomationStatus(item.AutomationExecutionStatus)
+}
+
+func isCompletedAutomationStatus(status types.AutomationExecutionStatus) (bool, bool) {
 	isCompleted := false
 	isSuccess := false
-	switch status := item.AutomationExecutionStatus; status {
+	switch status {
 	case types.AutomationExecutionStatusCompletedWithSuccess:
 		{
 			isCompleted = true
@@ -278,117 +465,209 @@ func (trackomate *Trackomate) isPendingStatus(item types.AutomationExecutionMeta
 
 func (trackomate *Trackomate) getStatusColor(item types.AutomationExecutionMetadata) string {
 	isCompleted, isSuccess := trackomate.isCompletedStatus(item)
+	return colorStatus(string(item.AutomationExecutionStatus), isCompleted, isSuccess)
+}
+
+func colorStatus(status string, isCompleted bool, isSuccess bool) string {
 	if !isCompleted {
 		// yellow
-		return "\033[33m" + string(item.AutomationExecutionStatus) + "\033[0m"
+		return "\033[33m" + status + "\033[0m"
 	}
 	if isSuccess {
 		// green
-		return "\033[32m" + string(item.AutomationExecutionStatus) + "\033[0m"
+		return "\033[32m" + status + "\033[0m"
 	} else {
 		// red
-		return "\033[31m" + string(item.AutomationExecutionStatus) + "\033[0m"
+		return "\033[31m" + status + "\033[0m"
 	}
 }
 
-func (trackomate *Trackomate) scheduleChildren() string {
-	childCheckId, err := trackomate.scheduler.Add(&tasks.Task{
-		Interval: time.Duration(2 * time.Second),
-		TaskFunc: func() error {
-			trackomate.checkChildren(trackomate.automationExecutionId)
-			*trackomate.reportChan <- "child ran"
-			return nil
-		},
+func (trackomate *Trackomate) scheduleChildren() {
+	trackomate.schedulePoll(newBackoff(trackomate.pollMin, trackomate.pollMax), func() bool {
+		isDone := trackomate.checkChildren(trackomate.automationExecutionId)
+		*trackomate.reportChan <- "child ran"
+		return isDone
 	})
-	exitOnError(err)
-	return childCheckId
 }
 
-func (trackomate *Trackomate) checkChildren(executionId string) {
-	childFilters := getFirstLevelChildren(executionId)
-	childrenInput := &ssm.DescribeAutomationExecutionsInput{
-		Filters:    childFilters,
-		MaxResults: &trackomate.maxRecords,
+// executions sorts the targets of every execution in the tree by how they ended.
+type executions struct {
+	allComplete bool
+	succeeded   []string
+	failed      []string
+	incomplete  []string
+}
+
+// checkChildren reports the whole tree below executionId, it is true once every execution in it and the parent
+// completed, as the parent may go on with steps of its own after its children. Without children it waits for the
+// parent alone: an execution started without targets, or read on an early poll, has none yet, and one that
+// completed without any ended with its own status.
+func (trackomate *Trackomate) checkChildren(executionId string) bool {
+	execs := executions{allComplete: true}
+	children, err := trackomate.walkChildren(executionId, 0, &execs)
+	if err != nil {
+		trackomate.skipPoll(err)
+		return false
+	}
+	parent, _ := trackomate.records()
+	if len(children) > 0 {
+		trackomate.setChildren(children)
+		trackomate.progress.redraw(parent, children)
+		trackomate.handleApprovals(children...)
 	}
-	resChildren, childrenServiceError := trackomate.svc.DescribeAutomationExecutions(context.Background(), childrenInput)
-	exitOnError(childrenServiceError)
-	if len(resChildren.AutomationExecutionMetadataList) == 0 {
-		exitOnError(&SesameError{msg: "No results for execution id."})
-	} else {
-		type Executions struct {
-			allComplete bool
-			succeeded   []string
-			failed      []string
-			incomplete  []string
-		}
-		execs := Executions{}
-		execs.allComplete = true
-		for _, item := range resChildren.AutomationExecutionMetadataList {
-			var name string
-			if strings.HasPrefix(*item.Target, "mi-") {
-				name = trackomate.getManagedInstanceTagValue(&item, "Name")
-			} else {
-				name = trackomate.getEC2InstanceTagValue(&item, "Name")
-			}
-			outs := item.Outputs
-			for s, k := range outs {
-				fmt.Fprintf(os.Stdout, "%s:%v", s, k)
-			}
-			isCompleted, isSuccess := trackomate.isCompletedStatus(item)
-			if isCompleted {
-				if isSuccess {
-					execs.succeeded = append(execs.succeeded, *item.Target)
-					//TODO: May or may not have children run commands
-				} else {
-					execs.failed = append(execs.failed, *item.Target)
-				}
-				fm := item.FailureMessage
-				if fm == nil {
-					none := ""
-					fm = &none
-				}
-				_, err := fmt.Fprintf(os.Stdout, " CHILD: what [%s]:[%s] %s[%s] : %s\n", *item.DocumentName, trackomate.getStatusColor(item), name, *item.Target, *fm)
-				if err != nil {
-					panic(err)
-				}
-				trackomate.getStepExecutions(&item)
-			} else {
-				execs.allComplete = false
-				execs.incomplete = append(execs.incomplete, *item.Target)
-				trackomate.getStepExecutions(&item)
-				_, err := fmt.Fprintf(os.Stdout, " CHILD: what [%s]:[%s] %s[%s] : %s\n", *item.DocumentName, trackomate.getStatusColor(item), name, *item.Target, "pending")
-				if err != nil {
-					panic(err)
-				}
-			}
 
-		}
+	isParentCompleted, _ := parent.isCompleted()
+	isDone := execs.allComplete && isParentCompleted
+	if isDone {
+		*trackomate.reportChan <- "DONE"
+	}
+	return isDone
+}
+
+// walkChildren reports the children of executionId and theirs, each level indented under the one above, so
+// automations calling aws:executeAutomation are tracked however deep they go.
+func (trackomate *Trackomate) walkChildren(executionId string, depth int, execs *executions) ([]ExecutionRecord, error) {
+	children, err := trackomate.walkLevel([]string{executionId}, depth, execs)
+	if err != nil {
+		return nil, err
+	}
+	return children[executionId], nil
+}
 
-		if execs.allComplete {
-			trackomate.scheduler.Del(trackomate.childrenSchedulerId)
-			*trackomate.reportChan <- "DONE"
-			trackomate.summaryStatusCode = len(execs.failed)
+// walkLevel reports the children of every one of parentIds, read together, by parent. Only the children with an
+// aws:executeAutomation step can have children of their own, the next level is read for those alone.
+func (trackomate *Trackomate) walkLevel(parentIds []string, depth int, execs *executions) (map[string][]ExecutionRecord, error) {
+	var items []types.AutomationExecutionMetadata
+	for start := 0; start < len(parentIds); start += maxFilterValues {
+		end := start + maxFilterValues
+		if end > len(parentIds) {
+			end = len(parentIds)
+		}
+		childrenInput := &ssm.DescribeAutomationExecutionsInput{
+			Filters:    getFirstLevelChildren(parentIds[start:end]...),
+			MaxResults: &trackomate.maxRecords,
+		}
+		described, childrenServiceError := describeAllExecutions(context.Background(), trackomate.svc, childrenInput)
+		if childrenServiceError != nil {
+			return nil, childrenServiceError
+		}
+		items = append(items, described...)
+	}
+	indent := strings.Repeat("  ", depth)
+	children := make(map[string][]ExecutionRecord)
+	var startingIds []string
+	for _, item := range items {
+		record, err := trackomate.childRecord(item, indent, execs)
+		if err != nil {
+			return nil, err
+		}
+		if startsAutomations(record.Steps) {
+			startingIds = append(startingIds, record.AutomationExecutionId)
+		}
+		children[record.ParentExecutionId] = append(children[record.ParentExecutionId], record)
+	}
+	if len(startingIds) == 0 {
+		return children, nil
+	}
+	grandchildren, err := trackomate.walkLevel(startingIds, depth+1, execs)
+	if err != nil {
+		return nil, err
+	}
+	for _, records := range children {
+		for i := range records {
+			records[i].Children = grandchildren[records[i].AutomationExecutionId]
 		}
 	}
+	return children, nil
 }
 
-func (trackomate *Trackomate) getManagedInstanceTagValue(item *types.AutomationExecutionMetadata, tagName string) string {
-	tagList := ssm.ListTagsForResourceInput{
-		ResourceId:   item.Target,
-		ResourceType: types.ResourceTypeForTaggingManagedInstance,
+// childRecord reports one child execution and its steps, sorting its target by how it ended.
+func (trackomate *Trackomate) childRecord(item types.AutomationExecutionMetadata, indent string, execs *executions) (ExecutionRecord, error) {
+	var err error
+	name := trackomate.getTargetName(&item)
+	target := aws.ToString(item.Target)
+	record := newExecutionRecord(item)
+	record.TargetName = name
+	outs := item.Outputs
+	for s, k := range outs {
+		trackomate.progress.printf(record.key()+"/outputs/"+s, fmt.Sprint(k), "%s%s:%v\n", indent, s, k)
 	}
-	tags, tagError := trackomate.svc.ListTagsForResource(context.Background(), &tagList)
-	exitOnError(tagError)
-	var name = ""
-	for _, v := range tags.TagList {
-		if *v.Key == tagName {
-			name = *v.Value
+	isCompleted, isSuccess := trackomate.isCompletedStatus(item)
+	if isCompleted {
+		if isSuccess {
+			execs.succeeded = append(execs.succeeded, target)
+			//TODO: May or may not have children run commands
+		} else {
+			execs.failed = append(execs.failed, target)
+		}
+		fm := item.FailureMessage
+		if fm == nil {
+			none := ""
+			fm = &none
+		}
+		trackomate.progress.printf(record.key(), record.Status, "%s CHILD: what [%s]:[%s] %s[%s] : %s\n", indent, *item.DocumentName, trackomate.getStatusColor(item), name, target, *fm)
+		record.Steps, err = trackomate.getStepExecutions(&item, indent)
+		if err != nil {
+			return ExecutionRecord{}, err
 		}
+	} else {
+		execs.allComplete = false
+		execs.incomplete = append(execs.incomplete, target)
+		record.Steps, err = trackomate.getStepExecutions(&item, indent)
+		if err != nil {
+			return ExecutionRecord{}, err
+		}
+		trackomate.progress.printf(record.key(), record.Status, "%s CHILD: what [%s]:[%s] %s[%s] : %s\n", indent, *item.DocumentName, trackomate.getStatusColor(item), name, target, "pending")
+	}
+	trackomate.events.child(record)
+	return record, nil
+}
+
+// startsAutomations is true when one of the steps is an aws:executeAutomation, the only way an execution gets
+// children of its own.
+func startsAutomations(steps []StepRecord) bool {
+	for _, step := range steps {
+		if step.Action == ActionExecuteAutomation {
+			return true
+		}
+	}
+	return false
+}
+
+func (trackomate *Trackomate) getTargetName(item *types.AutomationExecutionMetadata) string {
+	if item.Target == nil {
+		// nested automations started by aws:executeAutomation may have no target of their own
+		return ""
+	}
+	return trackomate.targetName(*item.Target)
+}
+
+// targetName is the alias of an instance, or else its Name tag.
+func (trackomate *Trackomate) targetName(target string) string {
+	if name, ok := loadAliases().NameOf(target); ok {
+		return name
+	}
+	return trackomate.getTargetTagValue(target, "Name")
+}
+
+func (trackomate *Trackomate) getTargetTagValue(target string, tagName string) string {
+	tags, tagError := trackomate.cache.instanceTags(target, func() (map[string]string, error) {
+		return trackomate.searcher().InstanceTags(context.Background(), target)
+	})
+	if tagError != nil && isTransientError(tagError) {
+		// a name is nice to have, not worth ending the run over
+		_, _ = fmt.Fprintf(reportOut(), "  REPORT: no %s tag for [%s]: %v\n", tagName, target, tagError)
+		return ""
 	}
-	return name
+	exitOnError(tagError)
+	return tags[tagName]
 }
 
 func (trackomate *Trackomate) thingDo() {
+	if trackomate.commandId != "" {
+		trackomate.thingDoCommand()
+		return
+	}
 
 	// sync check if parent exists
 	// if success, no reason to go async
@@ -402,98 +681,245 @@ func (trackomate *Trackomate) thingDo() {
 
 	parentEndState := trackomate.checkParent()
 	if !parentEndState.IsEndState {
-		trackomate.parentSchedulerId = trackomate.scheduleParent()
-		trackomate.childrenSchedulerId = trackomate.scheduleChildren()
+		trackomate.scheduleParent()
+		trackomate.scheduleChildren()
 	}
 
 	if parentEndState.IsEndState {
 		if parentEndState.IsEndStateSuccess {
-			_, err := fmt.Fprintf(os.Stdout, "PARENT: automation-id=[%s]: Success!\n", trackomate.automationExecutionId)
+			_, err := fmt.Fprintf(progressOut(), "PARENT: automation-id=[%s]: Success!\n", trackomate.automationExecutionId)
 			exitOnError(err)
 			trackomate.checkChildren(trackomate.automationExecutionId)
-		} else {
-			trackomate.summaryStatusCode = 1
 		}
 	}
 
 	if !parentEndState.IsEndState {
-		// Start the Scheduler
-
-		defer trackomate.scheduler.Stop()
-
-		if trackomate.maxPollCount < 0 {
-			trackomate.maxPollCount = math.MaxInt32
-		}
-		x := trackomate.maxPollCount
-		for i := 1; i < x-1; i++ {
-			if len(trackomate.scheduler.Tasks()) > 0 {
-				fmt.Println("Checking..")
-				c := trackomate.reportChan
-				report := <-*c
-				fmt.Printf("  REPORT: %s \n", report)
-				if report == "DONE" {
-					trackomate.scheduler.Stop()
-					break
+		trackomate.watch()
+	}
+	trackomate.finish()
+}
+
+// watch reads the reports of the scheduled checks until one is DONE, nothing is scheduled,
+// maxPollCount reports were read, --timeout passed or it was interrupted. An execution stopped on the way out
+// is watched on until it reached a terminal state.
+func (trackomate *Trackomate) watch() {
+	// Start the Scheduler
+
+	defer trackomate.stopPolling()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	var deadline <-chan time.Time
+	if trackomate.timeout > 0 {
+		timer := time.NewTimer(trackomate.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	if trackomate.maxPollCount < 0 {
+		trackomate.maxPollCount = math.MaxInt32
+	}
+	x := trackomate.maxPollCount
+	isGivingUp := true
+watching:
+	for i := 1; i < x-1; i++ {
+		if trackomate.polling.pending() > 0 {
+			if trackomate.progress.verbose {
+				_, _ = fmt.Fprintln(progressOut(), "Checking..")
+			}
+			c := trackomate.reportChan
+		waiting:
+			for {
+				select {
+				case report := <-*c:
+					if trackomate.progress.verbose {
+						_, _ = fmt.Fprintf(progressOut(), "  REPORT: %s \n", report)
+					}
+					if report == "DONE" {
+						isGivingUp = false
+						break watching
+					}
+					break waiting
+				case <-trackomate.approvals.ready:
+					trackomate.askNextApproval()
+				case answer, isOpen := <-trackomate.approvalAnswers():
+					trackomate.answerApproval(answer, isOpen)
+				case <-deadline:
+					isGivingUp = false
+					trackomate.timedOut()
+					break watching
+				case <-interrupts:
+					isGivingUp = false
+					trackomate.stopOnExit("Interrupted")
+					break watching
 				}
-			} else {
-				fmt.Printf("  REPORT: Nothing scheduled, ending watch! \n")
-				break
 			}
+		} else {
+			_, _ = fmt.Fprintf(progressOut(), "  REPORT: Nothing scheduled, ending watch! \n")
+			isGivingUp = false
+			break
 		}
-		fmt.Println("Stopping")
 	}
+	if isGivingUp {
+		trackomate.stopOnExit(fmt.Sprintf("Gave up after %d polls", trackomate.maxPollCount))
+	}
+	if trackomate.isStopping {
+		trackomate.untilStopped(interrupts)
+	}
+	_, _ = fmt.Fprintln(progressOut(), "Stopping")
+}
+
+func (trackomate *Trackomate) finish() {
+	liveOut.close()
+	retried, skipped := retriedCalls(), trackomate.skipped()
+	if retried > 0 || skipped > 0 {
+		_, _ = fmt.Fprintf(progressOut(), "  REPORT: %d AWS calls retried, %d polls skipped \n", retried, skipped)
+	}
+	parent, children := trackomate.records()
+	trackomate.events.summary(parent, children, retried, skipped)
+	exitOnError(trackomate.write())
+	if junitPath != "" {
+		exitOnError(writeJunit(junitPath, newJunitReport(parent, children)))
+		_, _ = fmt.Fprintf(progressOut(), "  REPORT: JUnit report written to %s \n", junitPath)
+	}
+	exitOnError(reportToGithub(parent, children))
 	trackomate.exitCheck()
 }
 
+// write prints the parent and child execution records for --output and --format,
+// the table form is the progress already printed.
+func (trackomate *Trackomate) write() error {
+	if !isMachineOutput() {
+		return nil
+	}
+	parent, children := trackomate.records()
+	items := []interface{}{parent}
+	for _, child := range children {
+		items = append(items, child)
+	}
+	return writeOutput(os.Stdout, items, func(w io.Writer) error { return nil })
+}
+
+// exitCheck exits with how the execution ended, unless it succeeded.
 func (trackomate *Trackomate) exitCheck() {
-	if isExitCodeTiedToAutomationStatus {
-		os.Exit(trackomate.summaryStatusCode)
+	if code := trackomate.exitCode(); code != ExitSuccess {
+		os.Exit(code)
+	}
+}
+
+// exitCode is how the execution and its children ended, unless summaryStatusCode was set for a status sesame
+// doesn't know. Once --timeout passed it is ExitTimeout, or ExitSuccess when --on-timeout leave left it running.
+func (trackomate *Trackomate) exitCode() int {
+	if trackomate.isTimedOut {
+		if trackomate.onTimeout == OnTimeoutLeave {
+			return ExitSuccess
+		}
+		return ExitTimeout
+	}
+	trackomate.mu.Lock()
+	defer trackomate.mu.Unlock()
+	if trackomate.summaryStatusCode != 0 {
+		return trackomate.summaryStatusCode
 	}
+	return automationExitCode(trackomate.parent, trackomate.children)
 }
 
-func (trackomate *Trackomate) getStepExecutions(item *types.AutomationExecutionMetadata) {
+// getStepExecutions reports the steps of a child and what their commands output, fetching them again only once
+// the child's status or current step changed.
+func (trackomate *Trackomate) getStepExecutions(item *types.AutomationExecutionMetadata, indent string) ([]StepRecord, error) {
+	executionId := aws.ToString(item.AutomationExecutionId)
+	fingerprint := stepsFingerprint(*item)
+	if steps, ok := trackomate.cache.cachedSteps(executionId, fingerprint); ok {
+		trackomate.printSteps(steps, indent)
+		return steps, nil
+	}
+	steps, err := trackomate.fetchStepExecutions(item, indent)
+	if err != nil {
+		return nil, err
+	}
+	trackomate.cache.putSteps(executionId, fingerprint, steps)
+	return steps, nil
+}
+
+// printSteps reports steps the way fetchStepExecutions does as it fetches them.
+func (trackomate *Trackomate) printSteps(steps []StepRecord, indent string) {
+	for _, step := range steps {
+		trackomate.progress.printf(step.StepExecutionId, step.Status, "%s CHILD: StepName:%s, Status:%s, execId:%s\n", indent, step.StepName, step.Status, step.StepExecutionId)
+	}
+	for _, step := range steps {
+		for _, command := range step.Commands {
+			trackomate.progress.output(indent+" CHILD", command)
+		}
+	}
+}
+
+func (trackomate *Trackomate) fetchStepExecutions(item *types.AutomationExecutionMetadata, indent string) ([]StepRecord, error) {
 	reverse := true
 	stepsInput := ssm.DescribeAutomationStepExecutionsInput{
 		AutomationExecutionId: item.AutomationExecutionId,
 		ReverseOrder:          &reverse,
 	}
 
-	steps, err := trackomate.svc.DescribeAutomationStepExecutions(context.Background(), &stepsInput)
-	exitOnError(err)
-	if len(steps.StepExecutions) == 0 {
-		return
-	} else {
-		for _, s := range steps.StepExecutions {
-			fmt.Printf(" CHILD: StepName:%s, Status:%s, execId:%s\n", *s.StepName, s.StepStatus, *s.StepExecutionId)
-		}
+	steps, err := describeAllStepExecutions(context.Background(), trackomate.svc, &stepsInput)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	records := make([]StepRecord, 0, len(steps))
+	for _, s := range steps {
+		trackomate.progress.printf(aws.ToString(s.StepExecutionId), string(s.StepStatus), "%s CHILD: StepName:%s, Status:%s, execId:%s\n", indent, *s.StepName, s.StepStatus, *s.StepExecutionId)
+		records = append(records, StepRecord{
+			StepName:           aws.ToString(s.StepName),
+			StepExecutionId:    aws.ToString(s.StepExecutionId),
+			Action:             aws.ToString(s.Action),
+			Status:             string(s.StepStatus),
+			FailureMessage:     aws.ToString(s.FailureMessage),
+			FailureDetails:     s.FailureDetails,
+			Inputs:             s.Inputs,
+			ExecutionStartTime: s.ExecutionStartTime,
+			ExecutionEndTime:   s.ExecutionEndTime,
+			Outputs:            s.Outputs,
+		})
 	}
 	getStepInput := ssm.GetAutomationExecutionInput{
 		AutomationExecutionId: item.AutomationExecutionId,
 	}
 	stepForCommand, notherErr := trackomate.svc.GetAutomationExecution(context.Background(), &getStepInput)
-	exitOnError(notherErr)
+	if notherErr != nil {
+		return nil, notherErr
+	}
 	for _, se := range stepForCommand.AutomationExecution.StepExecutions {
+		var commands []CommandRecord
 		for _, commandId := range se.Outputs["CommandId"] {
-			instanceIdInputWithFormating := se.Inputs["InstanceIds"]
-			instanceIdInputs := strings.Replace(strings.Replace(instanceIdInputWithFormating, "\"]", "", -1), "[\"", "", -1)
 			listCommandInput := ssm.ListCommandInvocationsInput{
-				CommandId:  &commandId,
-				InstanceId: &instanceIdInputs,
-				Details:    true,
+				CommandId: &commandId,
+				Details:   true,
+			}
+			if instanceId := stepInstanceId(se.Inputs["InstanceIds"]); instanceId != "" {
+				listCommandInput.InstanceId = &instanceId
+			}
+			commandInvs, moreErr := listAllCommandInvocations(context.Background(), trackomate.svc, &listCommandInput)
+			if moreErr != nil {
+				return nil, moreErr
 			}
-			commandInvs, moreErr := trackomate.svc.ListCommandInvocations(context.Background(), &listCommandInput)
-			exitOnError(moreErr)
-			for _, commandInv := range commandInvs.CommandInvocations {
+			for _, commandInv := range commandInvs {
 				for _, commandPlugins := range commandInv.CommandPlugins {
-					if commandPlugins.Output != nil && *commandPlugins.Output == "" {
-						fmt.Printf(" CHILD: [%s:%s]: output: -empty-\n", *commandPlugins.Name, commandId)
-					} else if commandPlugins.Output != nil {
-						fmt.Printf(" CHILD: [%s:%s]: output: \n\t%s\n", *commandPlugins.Name, commandId, strings.Replace(*commandPlugins.Output, "\n", "\n\t", -1))
-					}
+					command := trackomate.newCommandRecord(commandId, commandInv, commandPlugins)
+					trackomate.progress.output(indent+" CHILD", command)
+					commands = append(commands, command)
 				}
 			}
 		}
+		for i := range records {
+			if records[i].StepExecutionId == aws.ToString(se.StepExecutionId) {
+				records[i].Commands = commands
+			}
+		}
 	}
+	return records, nil
 }
 
 func (trackomate *Trackomate) getParent() []types.AutomationExecutionFilter {
@@ -509,37 +935,12 @@ func (trackomate *Trackomate) getParent() []types.AutomationExecutionFilter {
 	return filters
 }
 
-func (trackomate *Trackomate) getEC2InstanceTagValue(item *types.AutomationExecutionMetadata, tagName string) string {
-	maxResults := int32(50)
-
-	str := item.Target
-	strVals := []string{*str}
-	tagListFilter := ec2.DescribeTagsInput{
-		Filters: []ec2types.Filter{{
-			Name:   aws.String("resource-id"),
-			Values: strVals,
-		}},
-		MaxResults: &maxResults,
-	}
-	tags, tagError := trackomate.svcEc2.DescribeTags(context.Background(), &tagListFilter)
-	exitOnError(tagError)
-	var name = ""
-	for _, v := range tags.Tags {
-		if *v.Key == tagName {
-			name = *v.Value
-		}
-	}
-	return name
-}
-
-func getFirstLevelChildren(executionId string) []types.AutomationExecutionFilter {
+func getFirstLevelChildren(executionIds ...string) []types.AutomationExecutionFilter {
 	key := "ParentExecutionId"
 	filters := []types.AutomationExecutionFilter{
 		{
-			Key: types.AutomationExecutionFilterKey(key),
-			Values: []string{
-				executionId,
-			},
+			Key:    types.AutomationExecutionFilterKey(key),
+			Values: executionIds,
 		},
 	}
 	return filters
@@ -549,12 +950,34 @@ func init() {
 	rootCmd.AddCommand(trackomateCmd)
 
 	trackomateCmd.Flags().StringVarP(&automationExecutionId, "id", "i", "", "Provide the AutomationExecutionId from an ssm start-automation-execution command")
-	trackomateCmd.Flags().IntVarP(&maxPollCount, "maxPollCount", "p", DefaultPendingPollCount, fmt.Sprintf("Provide a number of times to poll for pending tasks before giving up. (-1) will poll until overal terminal status reached."))
-	trackomateCmd.Flags().BoolVarP(&isExitCodeTiedToAutomationStatus, "tieAutomationStatusToExitCode", "e", false, fmt.Sprintf("-e=true should be used if you want a calling script to know there was a failure in the automation execution (default: false)."))
+	trackomateCmd.Flags().StringVarP(&commandId, "command-id", "c", "", "Provide the CommandId from an ssm send-command command, instead of --id")
+	addTrackingFlags(trackomateCmd)
 
-	err := trackomateCmd.MarkFlagRequired("id")
+	err := trackomateCmd.RegisterFlagCompletionFunc("id", executionCompletions)
 	if err != nil {
-		return
+		exitOnError(err)
 	}
+}
 
+// addTrackingFlags adds the flags deciding how long and how an execution is tracked, and what is reported, to cmd.
+func addTrackingFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&maxPollCount, "maxPollCount", "p", DefaultPendingPollCount, fmt.Sprintf("Provide a number of times to poll for pending tasks before giving up. (-1) will poll until overal terminal status reached."))
+	cmd.Flags().DurationVar(&trackomateTimeout, "timeout", 0, "Provide how long to track before giving up, e.g. 45m, replaces --maxPollCount. (default: no limit)")
+	cmd.Flags().StringVar(&onTimeout, "on-timeout", OnTimeoutFail, fmt.Sprintf("Provide what to do once --timeout passed, one of %v: exit non-zero, exit leaving the execution running, or stop it and exit non-zero.", onTimeoutActions))
+	cmd.Flags().DurationVar(&pollMin, "poll-min", DefaultPollMin, "Provide the first poll interval, it doubles on every poll up to --poll-max.")
+	cmd.Flags().DurationVar(&pollMax, "poll-max", DefaultPollMax, "Provide the longest poll interval.")
+	cmd.Flags().StringVar(&trackomateEvents, "events", "", fmt.Sprintf("Provide %s to stream one JSON object per parent, child, step and command state change, and a final summary, on stdout.", EventsNdjson))
+	cmd.Flags().StringVar(&cancelOnExit, "cancel-on-exit", CancelOnExitAsk, fmt.Sprintf("Provide what to do with the execution still running on Ctrl-C, or giving up after --maxPollCount, one of %v: ask at a terminal and leave it otherwise, leave it, StopAutomationExecution with Cancel or with Complete. Also the stop type of --on-timeout=stop.", cancelOnExitActions))
+	cmd.Flags().StringArrayVar(&autoApproveIf, "auto-approve-if", nil, fmt.Sprintf("Provide a rule of comma separated key=glob conditions, keys one of %v, approving, or resuming an aws:pause step, whatever waits and matches them all, e.g. \"doc=Patch*,step=approveProd\". Repeat for more rules.", approvalRuleKeys))
+	cmd.Flags().BoolVar(&isFullOutput, "full-output", true, "Provide false to keep command output SSM truncated to 2500 characters, instead of reading it in full from the command's S3 bucket or CloudWatch log group.")
+	cmd.Flags().StringVar(&saveOutputDir, "save-output", "", "Provide a directory to save the stdout and stderr of every command to, one directory per host.")
+	cmd.Flags().StringVar(&s3Endpoint, "s3-endpoint", "", "Provide an S3 endpoint URL to read full command output from, e.g. a local stand-in at http://localhost:4566.")
+	cmd.Flags().StringVar(&logsEndpoint, "logs-endpoint", "", "Provide a CloudWatch Logs endpoint URL to read full command output from.")
+	cmd.Flags().StringVar(&junitPath, "junit", "", "Provide a file to write a JUnit XML report to, one testsuite per child target and one testcase per step.")
+	cmd.Flags().BoolVarP(&isVerbose, "verbose", "v", false, "Provide to print every child, step and command output on every poll, instead of only what changed since the last one.")
+	cmd.Flags().BoolVarP(&isExitCodeTiedToAutomationStatus, "tieAutomationStatusToExitCode", "e", false, "Kept for compatibility, does nothing.")
+	err := cmd.Flags().MarkDeprecated("tieAutomationStatusToExitCode", fmt.Sprintf("it does nothing, the exit code always tells how the execution ended: %d when it failed, %d when only some targets did and %d when it was still running.", ExitFailed, ExitPartial, ExitTimeout))
+	if err != nil {
+		exitOnError(err)
+	}
 }
@@ -1,8 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 	"github.com/madflojo/tasks"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -10,11 +21,10 @@ import (
 var countChan = make(chan bool, 10)
 
 var x = 10
-var count = 1
+var count int64 = 1
 var task = func() error {
 
-	fmt.Printf("doing my thing %d\n", count)
-	count++
+	fmt.Printf("doing my thing %d\n", atomic.AddInt64(&count, 1)-1)
 	countChan <- true
 	return nil
 }
@@ -43,3 +53,296 @@ func TestSchedular(t *testing.T) {
 	fmt.Println("Stopping")
 	scheduler.Del(id)
 }
+
+// pagedExecutions serves ids a page at a time, like DescribeAutomationExecutions does past 50 executions.
+type pagedExecutions struct {
+	pages [][]string
+	calls int
+}
+
+func (p *pagedExecutions) DescribeAutomationExecutions(ctx context.Context, input *ssm.DescribeAutomationExecutionsInput, optFns ...func(*ssm.Options)) (*ssm.DescribeAutomationExecutionsOutput, error) {
+	page := 0
+	if input.NextToken != nil {
+		page, _ = strconv.Atoi(*input.NextToken)
+	}
+	p.calls++
+	out := &ssm.DescribeAutomationExecutionsOutput{}
+	for _, id := range p.pages[page] {
+		out.AutomationExecutionMetadataList = append(out.AutomationExecutionMetadataList, types.AutomationExecutionMetadata{AutomationExecutionId: aws.String(id)})
+	}
+	if page+1 < len(p.pages) {
+		out.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return out, nil
+}
+
+func TestDescribeAllExecutions(t *testing.T) {
+	var first, second []string
+	for i := 0; i < ApiMax; i++ {
+		first = append(first, fmt.Sprintf("child-%d", i))
+	}
+	second = []string{"child-50", "child-51"}
+	client := &pagedExecutions{pages: [][]string{first, second}}
+	executions, err := describeAllExecutions(context.Background(), client, &ssm.DescribeAutomationExecutionsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != ApiMax+2 || client.calls != 2 {
+		t.Errorf("expected %d executions in 2 calls, got %d in %d", ApiMax+2, len(executions), client.calls)
+	}
+	if *executions[len(executions)-1].AutomationExecutionId != "child-51" {
+		t.Errorf("expected the last page to be read, got %s", *executions[len(executions)-1].AutomationExecutionId)
+	}
+}
+
+func TestStepInstanceId(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{`["mi-01d856ea25bf2f111"]`, "mi-01d856ea25bf2f111"},
+		{`["i-1","i-2"]`, ""},
+		{`[]`, ""},
+		{`mi-01d856ea25bf2f111`, "mi-01d856ea25bf2f111"},
+		{``, ""},
+	}
+	for _, c := range cases {
+		if actual := stepInstanceId(c.input); actual != c.expected {
+			t.Errorf("[%s]: expected %q, got %q", c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestIsCompletedCommandStatus(t *testing.T) {
+	cases := []struct {
+		status      string
+		isCompleted bool
+		isSuccess   bool
+	}{
+		{"Success", true, true},
+		{"Pending", false, false},
+		{"InProgress", false, false},
+		{"Delayed", false, false},
+		{"Cancelling", false, false},
+		{"Failed", true, false},
+		{"TimedOut", true, false},
+		{"Cancelled", true, false},
+		{"Canceled", true, false},
+		{"DeliveryTimedOut", true, false},
+		{"ExecutionTimedOut", true, false},
+		{"Undeliverable", true, false},
+		{"Terminated", true, false},
+		{"NoInstancesInTag", true, false},
+		{"In Progress", false, false},
+		{"Delivery Timed Out", true, false},
+		{"Execution Timed Out", true, false},
+		{"No Instances In Tag", true, false},
+	}
+	for _, c := range cases {
+		isCompleted, isSuccess := isCompletedCommandStatus(c.status)
+		if isCompleted != c.isCompleted || isSuccess != c.isSuccess {
+			t.Errorf("[%s]: expected %v/%v, got %v/%v", c.status, c.isCompleted, c.isSuccess, isCompleted, isSuccess)
+		}
+	}
+}
+
+func TestCountCommandInvocations(t *testing.T) {
+	invocations := []ExecutionRecord{
+		{CommandId: "c-1", Target: "mi-1", Status: "Success"},
+		{CommandId: "c-1", Target: "mi-2", Status: "Undeliverable"},
+		{CommandId: "c-1", Target: "mi-3", Status: "Delayed"},
+		{CommandId: "c-1", Target: "mi-4", Status: "In Progress"},
+	}
+	succeeded, failed, pending := countChildren(invocations)
+	if succeeded != 1 || failed != 1 || pending != 2 {
+		t.Errorf("expected 1/1/2, got %d/%d/%d", succeeded, failed, pending)
+	}
+}
+
+// fakeAutomations answers DescribeAutomationExecutions, DescribeAutomationStepExecutions and GetAutomationExecution
+// from memory, for an ssm.Client pointed at it, and counts the calls of each. update, when set, moves the
+// executions along before each call is answered, from the call and its filters.
+type fakeAutomations struct {
+	mu         sync.Mutex
+	executions []types.AutomationExecutionMetadata
+	steps      map[string][]types.StepExecution
+	calls      map[string]int
+	update     func(f *fakeAutomations, operation string, filters []types.AutomationExecutionFilter)
+}
+
+func (f *fakeAutomations) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSSM.")
+	f.calls[operation]++
+	var input struct {
+		AutomationExecutionId string
+		Filters               []types.AutomationExecutionFilter
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if f.update != nil {
+		f.update(f, operation, input.Filters)
+	}
+	var out interface{}
+	switch operation {
+	case "DescribeAutomationExecutions":
+		list := []types.AutomationExecutionMetadata{}
+		for _, execution := range f.executions {
+			if f.matches(execution, input.Filters) {
+				list = append(list, execution)
+			}
+		}
+		out = map[string]interface{}{"AutomationExecutionMetadataList": list}
+	case "DescribeAutomationStepExecutions":
+		out = map[string]interface{}{"StepExecutions": f.steps[input.AutomationExecutionId]}
+	case "GetAutomationExecution":
+		out = map[string]interface{}{"AutomationExecution": map[string]interface{}{
+			"AutomationExecutionId": input.AutomationExecutionId,
+			"StepExecutions":        f.steps[input.AutomationExecutionId],
+		}}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeAutomations) matches(execution types.AutomationExecutionMetadata, filters []types.AutomationExecutionFilter) bool {
+	for _, filter := range filters {
+		value := aws.ToString(execution.AutomationExecutionId)
+		if filter.Key == types.AutomationExecutionFilterKeyParentExecutionId {
+			value = aws.ToString(execution.ParentAutomationExecutionId)
+		}
+		found := false
+		for _, v := range filter.Values {
+			found = found || v == value
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeAutomations) callsTo(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[operation]
+}
+
+// newFakeTrackomate tracks automationExecutionId against a fakeAutomations.
+func newFakeTrackomate(t *testing.T, automationExecutionId string, fake *fakeAutomations) *Trackomate {
+	fake.calls = make(map[string]int)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	trackomate := newTrackomate(automationExecutionId, 10)
+	trackomate.svc = ssm.New(ssm.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+	})
+	trackomate.pollMin, trackomate.pollMax = 10*time.Millisecond, 20*time.Millisecond
+	return trackomate
+}
+
+func execution(id string, parentId string, status types.AutomationExecutionStatus) types.AutomationExecutionMetadata {
+	execution := types.AutomationExecutionMetadata{AutomationExecutionId: aws.String(id), DocumentName: aws.String("Patch"), AutomationExecutionStatus: status}
+	if parentId != "" {
+		execution.ParentAutomationExecutionId = aws.String(parentId)
+	}
+	return execution
+}
+
+func TestWalkChildrenReadsEachLevelOnce(t *testing.T) {
+	step := func(id string, action string) types.StepExecution {
+		return types.StepExecution{StepExecutionId: aws.String(id), StepName: aws.String(id), Action: aws.String(action), StepStatus: types.AutomationExecutionStatusSuccess}
+	}
+	fake := &fakeAutomations{
+		executions: []types.AutomationExecutionMetadata{
+			execution("child-1", "parent-1", types.AutomationExecutionStatusSuccess),
+			execution("child-2", "parent-1", types.AutomationExecutionStatusSuccess),
+			execution("child-3", "parent-1", types.AutomationExecutionStatusSuccess),
+			execution("grandchild-1", "child-2", types.AutomationExecutionStatusSuccess),
+			execution("grandchild-2", "child-3", types.AutomationExecutionStatusSuccess),
+		},
+		steps: map[string][]types.StepExecution{
+			"child-1": {step("run-1", "aws:runCommand")},
+			"child-2": {step("nested-2", ActionExecuteAutomation)},
+			"child-3": {step("nested-3", ActionExecuteAutomation)},
+		},
+	}
+	trackomate := newFakeTrackomate(t, "parent-1", fake)
+	execs := executions{allComplete: true}
+	children, err := trackomate.walkChildren("parent-1", 0, &execs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 3 || len(children[0].Children) != 0 || len(children[1].Children) != 1 || len(children[2].Children) != 1 {
+		t.Fatalf("expected the grandchildren under child-2 and child-3, got %+v", children)
+	}
+	if children[1].Children[0].AutomationExecutionId != "grandchild-1" || len(execs.succeeded) != 5 {
+		t.Errorf("expected grandchild-1 under child-2 and 5 succeeded, got %s and %v", children[1].Children[0].AutomationExecutionId, execs.succeeded)
+	}
+	if calls := fake.callsTo("DescribeAutomationExecutions"); calls != 2 {
+		t.Errorf("expected one DescribeAutomationExecutions per level, got %d", calls)
+	}
+}
+
+func TestThingDoWithoutChildrenYet(t *testing.T) {
+	parent := func(status types.AutomationExecutionStatus) types.AutomationExecutionMetadata {
+		return execution("parent-1", "", status)
+	}
+	child := func(status types.AutomationExecutionStatus) types.AutomationExecutionMetadata {
+		return execution("child-1", "parent-1", status)
+	}
+	cases := []struct {
+		name string
+		// next is what the parent and its children are once the children were read childReads times
+		next     func(childReads int) []types.AutomationExecutionMetadata
+		children int
+	}{
+		{"started without targets", func(childReads int) []types.AutomationExecutionMetadata {
+			if childReads < 3 {
+				return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusInprogress)}
+			}
+			return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusSuccess)}
+		}, 0},
+		{"children listed after the first polls, done before the parent", func(childReads int) []types.AutomationExecutionMetadata {
+			switch {
+			case childReads < 3:
+				return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusInprogress)}
+			case childReads < 5:
+				return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusInprogress), child(types.AutomationExecutionStatusInprogress)}
+			case childReads < 7:
+				return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusInprogress), child(types.AutomationExecutionStatusSuccess)}
+			}
+			return []types.AutomationExecutionMetadata{parent(types.AutomationExecutionStatusSuccess), child(types.AutomationExecutionStatusSuccess)}
+		}, 1},
+	}
+	for _, c := range cases {
+		childReads := 0
+		fake := &fakeAutomations{update: func(f *fakeAutomations, operation string, filters []types.AutomationExecutionFilter) {
+			if operation != "DescribeAutomationExecutions" {
+				return
+			}
+			if len(filters) > 0 && filters[0].Key == types.AutomationExecutionFilterKeyParentExecutionId {
+				childReads++
+			}
+			f.executions = c.next(childReads)
+		}}
+		trackomate := newFakeTrackomate(t, "parent-1", fake)
+		trackomate.maxPollCount = -1
+		trackomate.thingDo()
+		parent, children := trackomate.records()
+		if parent.Status != string(types.AutomationExecutionStatusSuccess) || len(children) != c.children {
+			t.Errorf("[%s]: expected the parent to succeed with %d children, got %s with %d", c.name, c.children, parent.Status, len(children))
+		}
+		if code := trackomate.exitCode(); code != ExitSuccess {
+			t.Errorf("[%s]: expected %d, got %d", c.name, ExitSuccess, code)
+		}
+	}
+}
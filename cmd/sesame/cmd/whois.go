@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	ssmsearch "github.com/Heraclitus/sesame/pkg/aws/ssm"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var whoisTag string
+
+// instanceIdPattern finds managed (mi-) and EC2 (i-) ids, even inside pipeline log lines.
+var instanceIdPattern = regexp.MustCompile(`\b(mi-[0-9a-f]{17}|i-[0-9a-f]{8}(?:[0-9a-f]{9})?)\b`)
+
+type Whois struct {
+	SSMCommand
+}
+
+// WhoisResult is an instance id resolved back to the names people know it by.
+type WhoisResult struct {
+	ssmsearch.Instance
+	Nickname string
+	// IsManaged is false for EC2 instances SSM doesn't know, only their tags are available.
+	IsManaged bool
+}
+
+// whoisCmd represents the whois command
+var whoisCmd = &cobra.Command{
+	Use:   "whois [mi-...|i-...]...",
+	Short: "resolve instance ids back to their nickname and tags",
+	Long: `Print the nickname, tags, ping status, platform, agent version, IP and last ping of managed (mi-) or EC2 (i-) instances.
+
+Without arguments, or with "-", instance ids are read from stdin, so logs can be piped in:
+  grep FAILED deploy.log | sesame whois`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var ids []string
+		if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
+			var err error
+			ids, err = readInstanceIds(os.Stdin)
+			exitOnError(err)
+		} else {
+			for _, arg := range args {
+				if !ssmsearch.IsInstanceId(arg) {
+					exitOnError(&SesameError{msg: fmt.Sprintf("not an instance id [%s]", arg)})
+				}
+				ids = appendUnique(ids, arg)
+			}
+		}
+		if len(ids) == 0 {
+			exitOnError(&SesameError{msg: "No instance ids provided."})
+		}
+
+		w := Whois{SSMCommand{}}
+		w.conf()
+		w.thingDo(ids)
+	},
+}
+
+func readInstanceIds(r io.Reader) ([]string, error) {
+	var ids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, id := range instanceIdPattern.FindAllString(scanner.Text(), -1) {
+			ids = appendUnique(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func (whois *Whois) thingDo(ids []string) {
+	results, missing, err := whois.lookup(context.Background(), ids)
+	exitOnError(err)
+	exitOnError(whois.write(results))
+	for _, id := range missing {
+		_, _ = fmt.Fprintf(os.Stderr, "No results for instance id [%s]\n", id)
+	}
+	if len(missing) > 0 {
+		os.Exit(partialExitCode(len(results)))
+	}
+}
+
+func (whois *Whois) lookup(ctx context.Context, ids []string) ([]WhoisResult, []string, error) {
+	instances, err := whois.searcher().DescribeInstances(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	managed := make(map[string]ssmsearch.Instance)
+	for _, instance := range instances {
+		managed[instance.InstanceId] = instance
+	}
+
+	var results []WhoisResult
+	var missing []string
+	for _, id := range ids {
+		if instance, ok := managed[id]; ok {
+			results = append(results, WhoisResult{Instance: instance, Nickname: whois.nickname(instance), IsManaged: true})
+			continue
+		}
+		if strings.HasPrefix(id, "mi-") {
+			missing = append(missing, id)
+			continue
+		}
+		tags, err := whois.searcher().InstanceTags(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tags) == 0 {
+			missing = append(missing, id)
+			continue
+		}
+		instance := ssmsearch.Instance{InstanceId: id, Tags: tags}
+		results = append(results, WhoisResult{Instance: instance, Nickname: whois.nickname(instance)})
+	}
+	return results, missing, nil
+}
+
+// nickname prefers the --tag tag, then the Name tag, then the name SSM has for the host.
+func (whois *Whois) nickname(instance ssmsearch.Instance) string {
+	if v, ok := instance.Tags[whoisTag]; ok {
+		return v
+	}
+	if v, ok := instance.Tags["Name"]; ok {
+		return v
+	}
+	return instance.Name
+}
+
+func (whois *Whois) write(results []WhoisResult) error {
+	items := make([]interface{}, len(results))
+	for i := range results {
+		items[i] = results[i]
+	}
+	return writeOutput(os.Stdout, items, func(w io.Writer) error {
+		tw := newTableWriter(w)
+		_, err := fmt.Fprintln(tw, "INSTANCE ID\tNICKNAME\tPING STATUS\tPLATFORM\tAGENT\tIP\tLAST PING\tTAGS")
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			lastPing := ""
+			if r.LastPingDateTime != nil {
+				lastPing = r.LastPingDateTime.Format(time.RFC3339)
+			}
+			platform := strings.TrimSpace(fmt.Sprintf("%s %s %s", r.PlatformType, r.PlatformName, r.PlatformVersion))
+			if !r.IsManaged {
+				platform = "(not managed by SSM)"
+			}
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.InstanceId, r.Nickname, r.PingStatus, platform, r.AgentVersion, r.IPAddress, lastPing, formatTags(r.Tags))
+			if err != nil {
+				return err
+			}
+		}
+		return tw.Flush()
+	})
+}
+
+// formatTags renders tags as key=value pairs sorted by key.
+func formatTags(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func init() {
+	rootCmd.AddCommand(whoisCmd)
+
+	whoisCmd.Flags().StringVarP(&whoisTag, "tag", "t", ssmsearch.DefaultNicknameTag, "Provide the tag name holding the nickname, Name is used when it's missing.")
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadInstanceIds(t *testing.T) {
+	log := `2026-10-18 deploy FAILED on mi-01d856ea25bf2f111 (DrStrange)
+2026-10-18 deploy OK on i-0abc1234def567890 and i-12345678
+retry mi-01d856ea25bf2f111, ignore mi-short and xi-12345678z`
+	ids, err := readInstanceIds(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"mi-01d856ea25bf2f111", "i-0abc1234def567890", "i-12345678"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+}
@@ -0,0 +1,131 @@
+// Package fulloutput reads the full output of a Run Command plugin from where SSM keeps it, an S3 bucket or a
+// CloudWatch Logs group, once the copy ListCommandInvocations returns was truncated.
+package fulloutput
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	logstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// TruncatedMarker ends a plugin's output once SSM cut it to MaxOutput characters.
+const TruncatedMarker = "---Output truncated---"
+const MaxOutput = 2500
+
+var ErrNotFound = errors.New("no such output")
+
+// S3Client is the part of the S3 API Fetcher uses, *s3.Client satisfies it.
+type S3Client interface {
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Fetcher reads objects from S3 and log streams from CloudWatch Logs.
+type Fetcher struct {
+	S3   S3Client
+	Logs cloudwatchlogs.GetLogEventsAPIClient
+}
+
+// NewFetcher builds the S3 and CloudWatch Logs clients from cfg, with its credentials, retryer and API options.
+// s3Endpoint and logsEndpoint replace the regional AWS endpoints when set, S3 is then addressed path style.
+func NewFetcher(cfg aws.Config, s3Endpoint string, logsEndpoint string) *Fetcher {
+	return &Fetcher{
+		S3: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if s3Endpoint != "" {
+				o.BaseEndpoint = aws.String(s3Endpoint)
+				o.UsePathStyle = true
+			}
+		}),
+		Logs: cloudwatchlogs.NewFromConfig(cfg, func(o *cloudwatchlogs.Options) {
+			if logsEndpoint != "" {
+				o.BaseEndpoint = aws.String(logsEndpoint)
+			}
+		}),
+	}
+}
+
+// IsTruncated is true when output is the cut down copy SSM returns of a longer output.
+func IsTruncated(output string) bool {
+	return strings.HasSuffix(strings.TrimSpace(output), TruncatedMarker) || len(output) >= MaxOutput
+}
+
+// S3Object reads the object at key in bucket, region may be empty for the client's region.
+func (f *Fetcher) S3Object(ctx context.Context, bucket string, key string, region string) (string, error) {
+	out, err := f.S3.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}, inRegion(region))
+	if err != nil {
+		return "", notFound(err)
+	}
+	defer out.Body.Close()
+	body, err := io.ReadAll(out.Body)
+	return string(body), err
+}
+
+// S3Keys lists every key in bucket under prefix.
+func (f *Fetcher) S3Keys(ctx context.Context, bucket string, prefix string, region string) ([]string, error) {
+	var keys []string
+	pager := s3.NewListObjectsV2Paginator(f.S3, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx, inRegion(region))
+		if err != nil {
+			return nil, notFound(err)
+		}
+		for _, content := range page.Contents {
+			keys = append(keys, aws.ToString(content.Key))
+		}
+	}
+	return keys, nil
+}
+
+// LogEvents reads a whole log stream from the start, one line per event.
+func (f *Fetcher) LogEvents(ctx context.Context, group string, stream string) (string, error) {
+	var lines []string
+	pager := cloudwatchlogs.NewGetLogEventsPaginator(f.Logs, &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(group),
+		LogStreamName: aws.String(stream),
+		StartFromHead: aws.Bool(true),
+	}, func(o *cloudwatchlogs.GetLogEventsPaginatorOptions) {
+		// the forward token stays the same once the end of the stream was reached
+		o.StopOnDuplicateToken = true
+	})
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return "", notFound(err)
+		}
+		if len(page.Events) == 0 {
+			break
+		}
+		for _, event := range page.Events {
+			lines = append(lines, strings.TrimSuffix(aws.ToString(event.Message), "\n"))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// inRegion sends an S3 call to the bucket's region, when the command named one.
+func inRegion(region string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	}
+}
+
+// notFound wraps the errors of an object or log stream that doesn't exist in ErrNotFound.
+func notFound(err error) error {
+	var noSuchKey *s3types.NoSuchKey
+	var s3NotFound *s3types.NotFound
+	var noSuchStream *logstypes.ResourceNotFoundException
+	if errors.As(err, &noSuchKey) || errors.As(err, &s3NotFound) || errors.As(err, &noSuchStream) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package fulloutput
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// standIn answers like a local S3 and CloudWatch Logs would, from memory.
+func standIn(t *testing.T, objects map[string]string, streams map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("unsigned request %s %s", r.Method, r.URL)
+		}
+		if r.Method == http.MethodPost {
+			if r.Header.Get("X-Amz-Target") != "Logs_20140328.GetLogEvents" {
+				t.Errorf("unexpected target %s", r.Header.Get("X-Amz-Target"))
+			}
+			body, _ := io.ReadAll(r.Body)
+			var input struct {
+				LogGroupName  string `json:"logGroupName"`
+				LogStreamName string `json:"logStreamName"`
+				NextToken     string `json:"nextToken"`
+			}
+			if err := json.Unmarshal(body, &input); err != nil {
+				t.Fatal(err)
+			}
+			events, ok := streams[input.LogGroupName+":"+input.LogStreamName]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, `{"__type":"com.amazonaws.logs#ResourceNotFoundException","message":"The specified log stream does not exist."}`)
+				return
+			}
+			// one event per page, the last page repeats its token
+			page := 0
+			_, _ = fmt.Sscanf(input.NextToken, "f/%d", &page)
+			out := map[string]interface{}{"events": []map[string]string{}}
+			if page < len(events) {
+				out["events"] = []map[string]string{{"message": events[page]}}
+				page++
+			}
+			out["nextForwardToken"] = fmt.Sprintf("f/%d", page)
+			_ = json.NewEncoder(w).Encode(out)
+			return
+		}
+		if r.URL.Query().Get("list-type") == "2" {
+			bucket := strings.Trim(r.URL.Path, "/")
+			prefix := bucket + "/" + r.URL.Query().Get("prefix")
+			_, _ = fmt.Fprint(w, "<ListBucketResult>")
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) {
+					_, _ = fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", strings.SplitN(key, "/", 2)[1])
+				}
+			}
+			_, _ = fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+			return
+		}
+		object, ok := objects[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+			return
+		}
+		_, _ = fmt.Fprint(w, object)
+	}))
+}
+
+func testConfig(region string) aws.Config {
+	return aws.Config{Region: region, Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+	})}
+}
+
+func TestIsTruncated(t *testing.T) {
+	cases := []struct {
+		output      string
+		isTruncated bool
+	}{
+		{"all done", false},
+		{"", false},
+		{"lots of output\n" + TruncatedMarker + "\n", true},
+		{strings.Repeat("x", MaxOutput), true},
+	}
+	for _, c := range cases {
+		if IsTruncated(c.output) != c.isTruncated {
+			t.Errorf("[%.20q]: expected truncated=%v", c.output, c.isTruncated)
+		}
+	}
+}
+
+func TestS3(t *testing.T) {
+	server := standIn(t, map[string]string{
+		"logs/ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stdout": "the whole story",
+		"logs/ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stderr": "and its errors",
+		"logs/ssm/cmd-2/i-1/awsrunShellScript/0.awsrunShellScript/stdout": "another command",
+	}, nil)
+	defer server.Close()
+	fetcher := NewFetcher(testConfig("us-east-1"), server.URL, server.URL)
+
+	keys, err := fetcher.S3Keys(context.Background(), "logs", "ssm/cmd-1/i-1/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected the 2 keys of cmd-1, got %v", keys)
+	}
+	out, err := fetcher.S3Object(context.Background(), "logs", "ssm/cmd-1/i-1/awsrunShellScript/0.awsrunShellScript/stdout", "us-west-2")
+	if err != nil || out != "the whole story" {
+		t.Errorf("expected the object, got %q %v", out, err)
+	}
+	if _, err := fetcher.S3Object(context.Background(), "logs", "ssm/missing", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLogEvents(t *testing.T) {
+	server := standIn(t, nil, map[string][]string{
+		"/aws/ssm/AWS-RunShellScript:cmd-1/i-1/aws-runShellScript/stdout": {"line 1\n", "line 2\n", "line 3\n"},
+	})
+	defer server.Close()
+	fetcher := NewFetcher(testConfig("us-east-1"), server.URL, server.URL)
+
+	out, err := fetcher.LogEvents(context.Background(), "/aws/ssm/AWS-RunShellScript", "cmd-1/i-1/aws-runShellScript/stdout")
+	if err != nil || out != "line 1\nline 2\nline 3" {
+		t.Errorf("expected every page of the stream, got %q %v", out, err)
+	}
+	if _, err := fetcher.LogEvents(context.Background(), "/aws/ssm/AWS-RunShellScript", "cmd-1/i-1/aws-runShellScript/stderr"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// requestRecorder fails every request after noting where it was sent.
+type requestRecorder struct {
+	urls []string
+}
+
+func (r *requestRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.urls = append(r.urls, req.URL.Scheme+"://"+req.URL.Host+req.URL.EscapedPath())
+	return nil, errors.New("not sent")
+}
+
+func TestRegionalEndpoints(t *testing.T) {
+	recorder := &requestRecorder{}
+	cfg := testConfig("eu-west-1")
+	cfg.HTTPClient = recorder
+	cfg.RetryMaxAttempts = 1
+	fetcher := NewFetcher(cfg, "", "")
+	_, _ = fetcher.S3Object(context.Background(), "logs", "a b/stdout", "")
+	// a bucket with dots doesn't match the wildcard certificate as a host name
+	_, _ = fetcher.S3Object(context.Background(), "ssm.logs", "stdout", "us-west-2")
+	_, _ = fetcher.LogEvents(context.Background(), "/aws/ssm/AWS-RunShellScript", "cmd-1/i-1/aws-runShellScript/stdout")
+	expected := []string{
+		"https://logs.s3.eu-west-1.amazonaws.com/a%20b/stdout",
+		"https://s3.us-west-2.amazonaws.com/ssm.logs/stdout",
+		"https://logs.eu-west-1.amazonaws.com/",
+	}
+	if strings.Join(recorder.urls, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, recorder.urls)
+	}
+}
@@ -0,0 +1,460 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// attributes are the expression keys that name an SSM field instead of a tag, and the
+// DescribeInstanceInformation filter each can be pushed down to, if any. Use tag:<key> for a tag with one of these names.
+var attributes = map[string]attribute{
+	"id":              {filterKey: string(types.InstanceInformationFilterKeyInstanceIds), value: func(i Instance) string { return i.InstanceId }},
+	"ping":            {filterKey: string(types.InstanceInformationFilterKeyPingStatus), value: func(i Instance) string { return i.PingStatus }},
+	"platform":        {filterKey: string(types.InstanceInformationFilterKeyPlatformTypes), value: func(i Instance) string { return i.PlatformType }},
+	"resource":        {filterKey: string(types.InstanceInformationFilterKeyResourceType), value: func(i Instance) string { return i.ResourceType }},
+	"agent":           {filterKey: string(types.InstanceInformationFilterKeyAgentVersion), value: func(i Instance) string { return i.AgentVersion }},
+	"association":     {filterKey: string(types.InstanceInformationFilterKeyAssociationStatus), value: func(i Instance) string { return aws.ToString(i.Information.AssociationStatus) }},
+	"ip":              {value: func(i Instance) string { return i.IPAddress }},
+	"computer":        {value: func(i Instance) string { return i.ComputerName }},
+	"platformName":    {value: func(i Instance) string { return i.PlatformName }},
+	"platformVersion": {value: func(i Instance) string { return i.PlatformVersion }},
+}
+
+type attribute struct {
+	filterKey string
+	value     func(Instance) string
+}
+
+// Expression is a parsed host target such as
+//
+//	Env=prod and Team in (a,b) and not DeployLocked=true and ping=Online
+//
+// Keys are tag keys unless they are one of the attribute names (id, ping, platform, resource, agent,
+// association, ip, computer, platformName, platformVersion),
+// values are bare words or quoted strings and comparisons are exact. "not" binds tighter than "and",
+// which binds tighter than "or", parentheses group.
+type Expression struct {
+	source string
+	root   node
+}
+
+// ExpressionError points at the offending position of an expression.
+type ExpressionError struct {
+	Expression string
+	Pos        int
+	Msg        string
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("invalid target expression [%s] at %d: %s", e.Expression, e.Pos, e.Msg)
+}
+
+type node interface {
+	match(instance Instance) bool
+	// matchUntagged evaluates the node on a host whose tags aren't read yet, known is false when the
+	// outcome depends on them.
+	matchUntagged(instance Instance) (matched bool, known bool)
+}
+
+type andNode struct{ left, right node }
+type orNode struct{ left, right node }
+type notNode struct{ inner node }
+
+// compareNode is key=value, key!=value or key in (values...).
+type compareNode struct {
+	key     string
+	isTag   bool
+	values  []string
+	negated bool
+}
+
+func (n andNode) match(i Instance) bool { return n.left.match(i) && n.right.match(i) }
+func (n orNode) match(i Instance) bool  { return n.left.match(i) || n.right.match(i) }
+func (n notNode) match(i Instance) bool { return !n.inner.match(i) }
+
+func (n andNode) matchUntagged(i Instance) (bool, bool) {
+	left, isLeftKnown := n.left.matchUntagged(i)
+	right, isRightKnown := n.right.matchUntagged(i)
+	if (isLeftKnown && !left) || (isRightKnown && !right) {
+		return false, true
+	}
+	return true, isLeftKnown && isRightKnown
+}
+
+func (n orNode) matchUntagged(i Instance) (bool, bool) {
+	left, isLeftKnown := n.left.matchUntagged(i)
+	right, isRightKnown := n.right.matchUntagged(i)
+	if (isLeftKnown && left) || (isRightKnown && right) {
+		return true, true
+	}
+	return false, isLeftKnown && isRightKnown
+}
+
+func (n notNode) matchUntagged(i Instance) (bool, bool) {
+	matched, known := n.inner.matchUntagged(i)
+	return !matched, known
+}
+
+func (n compareNode) matchUntagged(i Instance) (bool, bool) {
+	if n.isTag {
+		return false, false
+	}
+	return n.match(i), true
+}
+
+func (n compareNode) match(i Instance) bool {
+	var actual string
+	var present bool
+	if n.isTag {
+		actual, present = i.Tags[n.key]
+	} else {
+		actual, present = attributes[n.key].value(i), true
+	}
+	found := false
+	for _, v := range n.values {
+		found = found || (present && v == actual)
+	}
+	return found != n.negated
+}
+
+// TagEquals is the expression for the single tag comparison key=value.
+func TagEquals(key string, value string) *Expression {
+	n := compareNode{key: key, isTag: true, values: []string{value}}
+	return &Expression{source: fmt.Sprintf("%s=%s", quoteKey(key), quoteValue(value)), root: n}
+}
+
+// quoteKey quotes keys that would otherwise read as an attribute, keyword or several tokens.
+func quoteKey(key string) string {
+	if _, ok := attributes[key]; ok {
+		return strconv.Quote(key)
+	}
+	return quoteValue(key)
+}
+
+func quoteValue(value string) string {
+	tokens, err := lex(value)
+	if err != nil || len(tokens) != 1 || tokens[0].kind != wordToken || tokens[0].text != value {
+		return strconv.Quote(value)
+	}
+	for _, keyword := range []string{"and", "or", "not", "in"} {
+		if strings.EqualFold(value, keyword) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// And combines expressions that must all match, nil expressions are skipped.
+func And(expressions ...*Expression) *Expression {
+	var out *Expression
+	for _, e := range expressions {
+		if e == nil {
+			continue
+		}
+		if out == nil {
+			out = e
+			continue
+		}
+		out = &Expression{source: fmt.Sprintf("(%s) and (%s)", out.source, e.source), root: andNode{out.root, e.root}}
+	}
+	return out
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Match evaluates the whole expression against a host.
+func (e *Expression) Match(instance Instance) bool {
+	return e.root.match(instance)
+}
+
+// mayMatch is false when the attributes of a host, read before its tags, already rule it out.
+func (e *Expression) mayMatch(instance Instance) bool {
+	matched, known := e.root.matchUntagged(instance)
+	return matched || !known
+}
+
+// Filters returns the DescribeInstanceInformation filters implied by the expression. Only positive
+// comparisons joined by top level "and"s can be pushed down, so Match must still be applied to the results.
+func (e *Expression) Filters() []types.InstanceInformationStringFilter {
+	var filters []types.InstanceInformationStringFilter
+	seen := make(map[string]bool)
+	for _, n := range conjuncts(e.root) {
+		c, ok := n.(compareNode)
+		if !ok || c.negated {
+			continue
+		}
+		key := "tag:" + c.key
+		if !c.isTag {
+			key = attributes[c.key].filterKey
+		}
+		if key == "" {
+			continue
+		}
+		// SSM ands repeated keys inconsistently, the client side Match covers the rest.
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		filters = append(filters, types.InstanceInformationStringFilter{Key: aws.String(key), Values: c.values})
+	}
+	return filters
+}
+
+func conjuncts(n node) []node {
+	if a, ok := n.(andNode); ok {
+		return append(conjuncts(a.left), conjuncts(a.right)...)
+	}
+	return []node{n}
+}
+
+// SearchByExpression pushes down what it can of the expression and evaluates the rest on the results. Tags are
+// only read for hosts whose attributes don't already rule them out.
+func (s *Searcher) SearchByExpression(ctx context.Context, expression *Expression) ([]Instance, error) {
+	instances, err := s.searchByFilters(ctx, expression.Filters(), expression.mayMatch)
+	if err != nil {
+		return nil, err
+	}
+	var matched []Instance
+	for _, instance := range instances {
+		if expression.Match(instance) {
+			matched = append(matched, instance)
+		}
+	}
+	return matched, nil
+}
+
+// ParseExpression parses a target expression, see Expression for the syntax.
+func ParseExpression(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: source, tokens: tokens}
+	if len(tokens) == 0 {
+		return nil, p.errorf("empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected [%s]", p.peek().text)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	quotedToken
+	symbolToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+const symbols = "=!(),"
+
+func lex(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '!' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{symbolToken, "!=", i})
+			i += 2
+		case strings.ContainsRune(symbols, r):
+			tokens = append(tokens, token{symbolToken, string(r), i})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				return nil, &ExpressionError{Expression: source, Pos: i, Msg: "unterminated quote"}
+			}
+			text := string(runes[i+1 : end])
+			if r == '"' {
+				unquoted, err := strconv.Unquote(string(runes[i : end+1]))
+				if err != nil {
+					return nil, &ExpressionError{Expression: source, Pos: i, Msg: err.Error()}
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, token{quotedToken, text, i})
+			i = end + 1
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(symbols+"\"'", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{wordToken, string(runes[start:i]), start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	pos := len([]rune(p.source))
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].pos
+	}
+	return &ExpressionError{Expression: p.source, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: symbolToken}
+}
+
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.kind == wordToken && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) isSymbol(symbol string) bool {
+	t := p.peek()
+	return t.kind == symbolToken && t.text == symbol
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isKeyword("not") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if p.isSymbol("(") {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isSymbol(")") {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	keyToken := p.peek()
+	if p.pos >= len(p.tokens) || keyToken.kind == symbolToken {
+		return nil, p.errorf("expected a key")
+	}
+	p.pos++
+	n := compareNode{key: keyToken.text, isTag: true}
+	if keyToken.kind == wordToken {
+		if strings.HasPrefix(n.key, "tag:") {
+			n.key = strings.TrimPrefix(n.key, "tag:")
+		} else if _, ok := attributes[n.key]; ok {
+			n.isTag = false
+		}
+	}
+
+	switch {
+	case p.isSymbol("="), p.isSymbol("!="):
+		n.negated = p.peek().text == "!="
+		p.pos++
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.values = []string{value}
+	case p.isKeyword("in"):
+		p.pos++
+		if !p.isSymbol("(") {
+			return nil, p.errorf("expected ( after in")
+		}
+		p.pos++
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, value)
+			if p.isSymbol(")") {
+				p.pos++
+				break
+			}
+			if !p.isSymbol(",") {
+				return nil, p.errorf("expected , or )")
+			}
+			p.pos++
+		}
+	default:
+		return nil, p.errorf("expected =, != or in after [%s]", keyToken.text)
+	}
+	return n, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.peek()
+	if p.pos >= len(p.tokens) || t.kind == symbolToken {
+		return "", p.errorf("expected a value")
+	}
+	p.pos++
+	return t.text, nil
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"testing"
+)
+
+func TestParseExpressionMatch(t *testing.T) {
+	host := Instance{
+		InstanceId: "mi-1",
+		PingStatus: "Online",
+		Tags:       map[string]string{"Env": "prod", "Team": "b", "DeployLocked": "false", "ping": "tagged", "Owner": "Dr Strange"},
+	}
+	cases := []struct {
+		expression string
+		isMatch    bool
+	}{
+		{"Env=prod", true},
+		{"Env!=prod", false},
+		{"Env=prod and Team in (a,b) and not DeployLocked=true and ping=Online", true},
+		{"Env=dev or Team=b", true},
+		{"Env=dev or (Team=b and ping=Offline)", false},
+		{"NOT Env=dev AND Team IN ( 'a' , \"b\" )", true},
+		{"tag:ping=tagged", true},
+		{"\"ping\"=tagged", true},
+		{"Owner=\"Dr Strange\"", true},
+		{"Missing!=x", true},
+		{"Missing=x", false},
+		{"id in (mi-2, mi-1)", true},
+	}
+	for _, c := range cases {
+		e, err := ParseExpression(c.expression)
+		if err != nil {
+			t.Errorf("[%s]: %v", c.expression, err)
+			continue
+		}
+		if e.Match(host) != c.isMatch {
+			t.Errorf("[%s]: expected match %v", c.expression, c.isMatch)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, source := range []string{"", "Env", "Env=", "Env=prod and", "(Env=prod", "Team in (a,b", "Env=\"prod", "Env=prod)"} {
+		_, err := ParseExpression(source)
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) {
+			t.Errorf("[%s]: expected an ExpressionError, got %v", source, err)
+		}
+	}
+}
+
+func TestExpressionFilters(t *testing.T) {
+	e, err := ParseExpression("Env=prod and Team in (a,b) and not DeployLocked=true and ping=Online and (Env=x or Env=y)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := e.Filters()
+	expected := map[string]int{"tag:Env": 1, "tag:Team": 2, "PingStatus": 1}
+	if len(filters) != len(expected) {
+		t.Fatalf("unexpected filters %+v", filters)
+	}
+	for _, f := range filters {
+		if expected[aws.ToString(f.Key)] != len(f.Values) {
+			t.Errorf("unexpected filter %s %v", aws.ToString(f.Key), f.Values)
+		}
+	}
+}
+
+func TestTagEqualsRoundTrips(t *testing.T) {
+	e := And(TagEquals("ping", "Dr Strange"), TagEquals("Env", "prod"))
+	reparsed, err := ParseExpression(e.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := Instance{Tags: map[string]string{"ping": "Dr Strange", "Env": "prod"}}
+	if !reparsed.Match(host) {
+		t.Errorf("[%s] should match %+v", e, host)
+	}
+}
+
+func TestSearchByExpression(t *testing.T) {
+	e, err := ParseExpression("Nickname=IronMan and not Env=dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := newFakeSearcher().SearchByExpression(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].InstanceId != "mi-2" {
+		t.Errorf("unexpected instances %+v", instances)
+	}
+}
+
+func TestSearchByExpressionReadsTagsOfAttributeMatchesOnly(t *testing.T) {
+	var hosts []fakeHost
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		h := managed("mi-"+ip, map[string]string{"Env": "prod"})
+		h.info.IPAddress = aws.String(ip)
+		hosts = append(hosts, h)
+	}
+	cases := []struct {
+		expression string
+		matched    int
+		tagCalls   int
+	}{
+		{"ip=10.0.0.1", 1, 1},
+		{"ip in (10.0.0.1, 10.0.0.2) and Env=prod", 2, 2},
+		{"not ip=10.0.0.1 and not Env=dev", 2, 2},
+		{"ip=10.0.0.1 or Env=prod", 3, 3},
+		{"computer=nowhere", 0, 0},
+	}
+	for _, c := range cases {
+		e, err := ParseExpression(c.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := &fakeSSM{hosts: hosts}
+		instances, err := NewSearcher(svc, &fakeEC2{}).SearchByExpression(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(instances) != c.matched || svc.tagCalls != c.tagCalls {
+			t.Errorf("[%s]: expected %d hosts from %d tag reads, got %d from %d", c.expression, c.matched, c.tagCalls, len(instances), svc.tagCalls)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"strings"
+)
+
+// inventoryOperators are checked in order so that != and ^= win over =.
+var inventoryOperators = []struct {
+	symbol   string
+	operator types.InventoryQueryOperatorType
+}{
+	{"!=", types.InventoryQueryOperatorTypeNotEqual},
+	{"^=", types.InventoryQueryOperatorTypeBeginWith},
+	{"=", types.InventoryQueryOperatorTypeEqual},
+	{"<", types.InventoryQueryOperatorTypeLessThan},
+	{">", types.InventoryQueryOperatorTypeGreaterThan},
+}
+
+// ParseInventoryFilter reads an SSM Inventory query such as AWS:Application.Name=nginx.
+// Besides = it knows != , ^= (begins with), < and >; several values may be given comma separated.
+func ParseInventoryFilter(query string) (types.InventoryFilter, error) {
+	for _, o := range inventoryOperators {
+		if i := strings.Index(query, o.symbol); i > 0 {
+			key := strings.TrimSpace(query[:i])
+			values := strings.Split(query[i+len(o.symbol):], ",")
+			for j := range values {
+				values[j] = strings.TrimSpace(values[j])
+			}
+			if !strings.Contains(key, ":") || !strings.Contains(key, ".") {
+				break
+			}
+			return types.InventoryFilter{Key: aws.String(key), Values: values, Type: o.operator}, nil
+		}
+	}
+	return types.InventoryFilter{}, fmt.Errorf("invalid inventory query [%s], expected e.g. AWS:Application.Name=nginx", query)
+}
+
+// SearchByInventory returns the ids of hosts whose SSM Inventory matches all of the filters.
+func (s *Searcher) SearchByInventory(ctx context.Context, filters []types.InventoryFilter) ([]string, error) {
+	maxRes := maxResults
+	input := &ssm.GetInventoryInput{
+		Filters:    filters,
+		MaxResults: &maxRes,
+	}
+	var ids []string
+	pager := ssm.NewGetInventoryPaginator(s.svc, input)
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range page.Entities {
+			ids = append(ids, aws.ToString(entity.Id))
+		}
+	}
+	return ids, nil
+}
@@ -1,7 +1,271 @@
+// Package search resolves SSM managed hosts from the nicknames and tags people know them by.
+//
+// It only needs the narrow Client and EC2Client interfaces, so the *ssm.Client and *ec2.Client
+// from aws-sdk-go-v2 can be passed straight in, or fakes in tests.
 package search
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"sort"
+	"strings"
+	"time"
+)
 
-func SearchByNickname(nickname  string, tag string) string {
-	return fmt.Sprintf("%s%s", nickname, tag)
-}
\ No newline at end of file
+const DefaultNicknameTag = "Nickname"
+
+// maxResults is the largest page DescribeInstanceInformation allows.
+const maxResults = int32(50)
+
+var ErrNotFound = errors.New("no results for instance search")
+var ErrAmbiguous = errors.New("too many results for instance search")
+
+// Client is the part of the SSM API host resolution uses, *ssm.Client satisfies it.
+type Client interface {
+	DescribeInstanceInformation(ctx context.Context, params *ssm.DescribeInstanceInformationInput, optFns ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error)
+	ListTagsForResource(ctx context.Context, params *ssm.ListTagsForResourceInput, optFns ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error)
+	GetInventory(ctx context.Context, params *ssm.GetInventoryInput, optFns ...func(*ssm.Options)) (*ssm.GetInventoryOutput, error)
+}
+
+// EC2Client is the part of the EC2 API used to read tags of EC2 hosts, *ec2.Client satisfies it.
+type EC2Client interface {
+	DescribeTags(ctx context.Context, params *ec2.DescribeTagsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error)
+}
+
+// Instance is a host registered with SSM along with all of its tags.
+type Instance struct {
+	InstanceId       string
+	Name             string
+	PingStatus       string
+	PlatformType     string
+	PlatformName     string
+	PlatformVersion  string
+	ResourceType     string
+	AgentVersion     string
+	IPAddress        string
+	ComputerName     string
+	LastPingDateTime *time.Time
+	Tags             map[string]string
+	// Information is the raw SSM record the fields above were read from.
+	Information types.InstanceInformation `json:"-"`
+}
+
+// SearchError carries the query and whatever matched, use errors.Is with ErrNotFound or ErrAmbiguous.
+type SearchError struct {
+	Query   string
+	Matches []Instance
+	Err     error
+}
+
+func (e *SearchError) Error() string {
+	return fmt.Sprintf("%s [%s]", e.Err, e.Query)
+}
+
+func (e *SearchError) Unwrap() error {
+	return e.Err
+}
+
+type Searcher struct {
+	svc    Client
+	svcEc2 EC2Client
+}
+
+func NewSearcher(svc Client, svcEc2 EC2Client) *Searcher {
+	return &Searcher{svc: svc, svcEc2: svcEc2}
+}
+
+// IsInstanceId tells managed (mi-) and EC2 (i-) instance ids apart from nicknames.
+func IsInstanceId(value string) bool {
+	return strings.HasPrefix(value, "mi-") || strings.HasPrefix(value, "i-")
+}
+
+// SearchByNickname returns every host whose tagKey tag is exactly nickname.
+func (s *Searcher) SearchByNickname(ctx context.Context, nickname string, tagKey string) ([]Instance, error) {
+	if tagKey == "" {
+		tagKey = DefaultNicknameTag
+	}
+	return s.SearchByTags(ctx, map[string][]string{tagKey: {nickname}})
+}
+
+// SearchByTags returns every host matching all of the tag keys, each with any of its values.
+// An empty map returns every host registered with SSM.
+func (s *Searcher) SearchByTags(ctx context.Context, tags map[string][]string) ([]Instance, error) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var filters []types.InstanceInformationStringFilter
+	for _, k := range keys {
+		filters = append(filters, types.InstanceInformationStringFilter{
+			Key:    aws.String(fmt.Sprintf("tag:%s", k)),
+			Values: tags[k],
+		})
+	}
+	return s.SearchByFilters(ctx, filters)
+}
+
+// SearchByFilters returns every host matching the DescribeInstanceInformation filters.
+func (s *Searcher) SearchByFilters(ctx context.Context, filters []types.InstanceInformationStringFilter) ([]Instance, error) {
+	return s.searchByFilters(ctx, filters, nil)
+}
+
+// searchByFilters is SearchByFilters leaving out the hosts isWanted, if given, rejects before their tags are read.
+func (s *Searcher) searchByFilters(ctx context.Context, filters []types.InstanceInformationStringFilter, isWanted func(Instance) bool) ([]Instance, error) {
+	maxRes := maxResults
+	input := &ssm.DescribeInstanceInformationInput{
+		Filters:    filters,
+		MaxResults: &maxRes,
+	}
+
+	var instances []Instance
+	pager := ssm.NewDescribeInstanceInformationPaginator(s.svc, input)
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.InstanceInformationList {
+			instance := toInstance(item)
+			if isWanted != nil && !isWanted(instance) {
+				continue
+			}
+			instance.Tags, err = s.itemTags(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
+
+// ResolveInstance returns the single host known by an instance id or by its tagKey nickname.
+func (s *Searcher) ResolveInstance(ctx context.Context, nameOrId string, tagKey string) (Instance, error) {
+	var instances []Instance
+	var err error
+	if IsInstanceId(nameOrId) {
+		instances, err = s.SearchByFilters(ctx, []types.InstanceInformationStringFilter{{
+			Key:    aws.String(string(types.InstanceInformationFilterKeyInstanceIds)),
+			Values: []string{nameOrId},
+		}})
+	} else {
+		instances, err = s.SearchByNickname(ctx, nameOrId, tagKey)
+	}
+	if err != nil {
+		return Instance{}, err
+	}
+	if len(instances) == 0 {
+		return Instance{}, &SearchError{Query: nameOrId, Err: ErrNotFound}
+	}
+	if len(instances) > 1 {
+		return Instance{}, &SearchError{Query: nameOrId, Matches: instances, Err: ErrAmbiguous}
+	}
+	return instances[0], nil
+}
+
+// DescribeInstances returns the hosts registered with SSM for the ids, in the order of ids. Ids SSM doesn't
+// know are left out, see InstanceTags for EC2 instances that aren't managed.
+func (s *Searcher) DescribeInstances(ctx context.Context, ids []string) ([]Instance, error) {
+	byId := make(map[string]Instance)
+	for start := 0; start < len(ids); start += int(maxResults) {
+		end := start + int(maxResults)
+		if end > len(ids) {
+			end = len(ids)
+		}
+		instances, err := s.SearchByFilters(ctx, []types.InstanceInformationStringFilter{{
+			Key:    aws.String(string(types.InstanceInformationFilterKeyInstanceIds)),
+			Values: ids[start:end],
+		}})
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			byId[instance.InstanceId] = instance
+		}
+	}
+	var ordered []Instance
+	for _, id := range ids {
+		if instance, ok := byId[id]; ok {
+			ordered = append(ordered, instance)
+		}
+	}
+	return ordered, nil
+}
+
+// InstanceTags returns the tags of a managed (mi-) or EC2 host by id.
+func (s *Searcher) InstanceTags(ctx context.Context, instanceId string) (map[string]string, error) {
+	if strings.HasPrefix(instanceId, "mi-") {
+		return s.managedInstanceTags(ctx, instanceId)
+	}
+	return s.ec2InstanceTags(ctx, instanceId)
+}
+
+// itemTags reads the tags of a host SSM listed, from EC2 or SSM depending on its resource type.
+func (s *Searcher) itemTags(ctx context.Context, item types.InstanceInformation) (map[string]string, error) {
+	if item.ResourceType == types.ResourceTypeEc2Instance {
+		return s.ec2InstanceTags(ctx, aws.ToString(item.InstanceId))
+	}
+	return s.managedInstanceTags(ctx, aws.ToString(item.InstanceId))
+}
+
+// toInstance is the host as SSM lists it, without its tags.
+func toInstance(item types.InstanceInformation) Instance {
+	return Instance{
+		InstanceId:       aws.ToString(item.InstanceId),
+		Name:             aws.ToString(item.Name),
+		PingStatus:       string(item.PingStatus),
+		PlatformType:     string(item.PlatformType),
+		PlatformName:     aws.ToString(item.PlatformName),
+		PlatformVersion:  aws.ToString(item.PlatformVersion),
+		ResourceType:     string(item.ResourceType),
+		AgentVersion:     aws.ToString(item.AgentVersion),
+		IPAddress:        aws.ToString(item.IPAddress),
+		ComputerName:     aws.ToString(item.ComputerName),
+		LastPingDateTime: item.LastPingDateTime,
+		Information:      item,
+	}
+}
+
+func (s *Searcher) managedInstanceTags(ctx context.Context, instanceId string) (map[string]string, error) {
+	input := &ssm.ListTagsForResourceInput{
+		ResourceId:   aws.String(instanceId),
+		ResourceType: types.ResourceTypeForTaggingManagedInstance,
+	}
+	out, err := s.svc.ListTagsForResource(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string)
+	for _, t := range out.TagList {
+		tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return tags, nil
+}
+
+func (s *Searcher) ec2InstanceTags(ctx context.Context, instanceId string) (map[string]string, error) {
+	input := &ec2.DescribeTagsInput{
+		Filters: []ec2types.Filter{{
+			Name:   aws.String("resource-id"),
+			Values: []string{instanceId},
+		}},
+	}
+	tags := make(map[string]string)
+	pager := ec2.NewDescribeTagsPaginator(s.svcEc2, input)
+	for pager.HasMorePages() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range page.Tags {
+			tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+	}
+	return tags, nil
+}
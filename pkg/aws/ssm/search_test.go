@@ -0,0 +1,196 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"strings"
+	"testing"
+)
+
+type fakeHost struct {
+	info types.InstanceInformation
+	tags map[string]string
+}
+
+// fakeSSM answers tag: and InstanceIds filters from memory, one host per page to exercise pagination.
+type fakeSSM struct {
+	hosts    []fakeHost
+	tagCalls int
+}
+
+func (f *fakeSSM) DescribeInstanceInformation(_ context.Context, params *ssm.DescribeInstanceInformationInput, _ ...func(*ssm.Options)) (*ssm.DescribeInstanceInformationOutput, error) {
+	var matched []types.InstanceInformation
+	for _, h := range f.hosts {
+		if f.matches(h, params.Filters) {
+			matched = append(matched, h.info)
+		}
+	}
+	start := 0
+	if params.NextToken != nil {
+		start = len(*params.NextToken)
+	}
+	out := &ssm.DescribeInstanceInformationOutput{}
+	if start < len(matched) {
+		out.InstanceInformationList = matched[start : start+1]
+		if start+1 < len(matched) {
+			out.NextToken = aws.String(strings.Repeat(".", start+1))
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSSM) matches(h fakeHost, filters []types.InstanceInformationStringFilter) bool {
+	for _, filter := range filters {
+		key := aws.ToString(filter.Key)
+		var value string
+		if key == string(types.InstanceInformationFilterKeyInstanceIds) {
+			value = aws.ToString(h.info.InstanceId)
+		} else {
+			value = h.tags[strings.TrimPrefix(key, "tag:")]
+		}
+		found := false
+		for _, v := range filter.Values {
+			found = found || v == value
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeSSM) ListTagsForResource(_ context.Context, params *ssm.ListTagsForResourceInput, _ ...func(*ssm.Options)) (*ssm.ListTagsForResourceOutput, error) {
+	f.tagCalls++
+	out := &ssm.ListTagsForResourceOutput{}
+	for _, h := range f.hosts {
+		if aws.ToString(h.info.InstanceId) == aws.ToString(params.ResourceId) {
+			for k, v := range h.tags {
+				out.TagList = append(out.TagList, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSSM) GetInventory(_ context.Context, params *ssm.GetInventoryInput, _ ...func(*ssm.Options)) (*ssm.GetInventoryOutput, error) {
+	out := &ssm.GetInventoryOutput{}
+	for _, h := range f.hosts {
+		if h.tags["App"] == params.Filters[0].Values[0] {
+			out.Entities = append(out.Entities, types.InventoryResultEntity{Id: h.info.InstanceId})
+		}
+	}
+	return out, nil
+}
+
+type fakeEC2 struct {
+	tags map[string]map[string]string
+}
+
+func (f *fakeEC2) DescribeTags(_ context.Context, params *ec2.DescribeTagsInput, _ ...func(*ec2.Options)) (*ec2.DescribeTagsOutput, error) {
+	out := &ec2.DescribeTagsOutput{}
+	for k, v := range f.tags[params.Filters[0].Values[0]] {
+		out.Tags = append(out.Tags, ec2types.TagDescription{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return out, nil
+}
+
+func managed(id string, tags map[string]string) fakeHost {
+	return fakeHost{types.InstanceInformation{InstanceId: aws.String(id), ResourceType: types.ResourceTypeManagedInstance, PingStatus: types.PingStatusOnline}, tags}
+}
+
+func newFakeSearcher() *Searcher {
+	svc := &fakeSSM{hosts: []fakeHost{
+		managed("mi-1", map[string]string{"Nickname": "DrStrange", "Env": "prod", "App": "nginx"}),
+		managed("mi-2", map[string]string{"Nickname": "IronMan", "Env": "prod"}),
+		managed("mi-3", map[string]string{"Nickname": "IronMan", "Env": "dev"}),
+		{types.InstanceInformation{InstanceId: aws.String("i-4"), ResourceType: types.ResourceTypeEc2Instance}, map[string]string{"Nickname": "Hulk"}},
+	}}
+	svcEc2 := &fakeEC2{tags: map[string]map[string]string{"i-4": {"Nickname": "Hulk"}}}
+	return NewSearcher(svc, svcEc2)
+}
+
+func TestSearchByNickname(t *testing.T) {
+	instances, err := newFakeSearcher().SearchByNickname(context.Background(), "IronMan", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 || instances[0].InstanceId != "mi-2" || instances[1].Tags["Env"] != "dev" {
+		t.Errorf("unexpected instances %+v", instances)
+	}
+}
+
+func TestSearchByTags(t *testing.T) {
+	instances, err := newFakeSearcher().SearchByTags(context.Background(), map[string][]string{"Nickname": {"IronMan", "DrStrange"}, "Env": {"prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Errorf("expected 2 instances, got %+v", instances)
+	}
+}
+
+func TestResolveInstance(t *testing.T) {
+	s := newFakeSearcher()
+	ctx := context.Background()
+
+	instance, err := s.ResolveInstance(ctx, "DrStrange", "Nickname")
+	if err != nil || instance.InstanceId != "mi-1" {
+		t.Errorf("expected mi-1, got %+v %v", instance, err)
+	}
+
+	instance, err = s.ResolveInstance(ctx, "i-4", "Nickname")
+	if err != nil || instance.Tags["Nickname"] != "Hulk" {
+		t.Errorf("expected EC2 tags for i-4, got %+v %v", instance, err)
+	}
+
+	_, err = s.ResolveInstance(ctx, "IronMan", "Nickname")
+	var searchErr *SearchError
+	if !errors.Is(err, ErrAmbiguous) || !errors.As(err, &searchErr) || len(searchErr.Matches) != 2 {
+		t.Errorf("expected ambiguous with 2 matches, got %v", err)
+	}
+
+	_, err = s.ResolveInstance(ctx, "Thor", "Nickname")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestSearchByInventory(t *testing.T) {
+	filter, err := ParseInventoryFilter("AWS:Application.Name=nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := newFakeSearcher().SearchByInventory(context.Background(), []types.InventoryFilter{filter})
+	if err != nil || len(ids) != 1 || ids[0] != "mi-1" {
+		t.Errorf("expected [mi-1], got %v %v", ids, err)
+	}
+}
+
+func TestParseInventoryFilter(t *testing.T) {
+	cases := []struct {
+		query    string
+		operator types.InventoryQueryOperatorType
+		values   int
+	}{
+		{"AWS:Application.Name=nginx", types.InventoryQueryOperatorTypeEqual, 1},
+		{"AWS:Application.Name != nginx", types.InventoryQueryOperatorTypeNotEqual, 1},
+		{"AWS:Application.Version^=1.2", types.InventoryQueryOperatorTypeBeginWith, 1},
+		{"AWS:Application.Name=nginx,httpd", types.InventoryQueryOperatorTypeEqual, 2},
+	}
+	for _, c := range cases {
+		f, err := ParseInventoryFilter(c.query)
+		if err != nil || f.Type != c.operator || len(f.Values) != c.values {
+			t.Errorf("[%s]: unexpected %+v %v", c.query, f, err)
+		}
+	}
+	for _, query := range []string{"nginx", "Name=nginx", "=nginx"} {
+		if _, err := ParseInventoryFilter(query); err == nil {
+			t.Errorf("[%s]: expected an error", query)
+		}
+	}
+}